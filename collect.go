@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/vinistoisr/zerotrust-exporter/internal/appmetrics"
+	"github.com/vinistoisr/zerotrust-exporter/internal/collector"
+	"github.com/vinistoisr/zerotrust-exporter/internal/exposition"
+)
+
+// Flags for the collect subcommand, only accepted after the collect command
+var (
+	collectFlags    = flag.NewFlagSet("collect", flag.ExitOnError)
+	collectOnce     = collectFlags.Bool("once", false, "Run the collectors a single time and exit")
+	collectOutput   = collectFlags.String("output", "-", "File to write metrics to, or - for stdout")
+	collectInterval = collectFlags.Duration("interval", time.Minute, "Interval between collections when not running once")
+)
+
+// commandFlags returns the flag set parsing the arguments of command. The collect and
+// inspection commands accept their own flags in addition to the global ones.
+func commandFlags(command string) *flag.FlagSet {
+	var flags *flag.FlagSet
+	switch command {
+	case "collect":
+		flags = collectFlags
+	case "devices", "tunnels", "dex", "users":
+		flags = inspectFlags
+	default:
+		return flag.CommandLine
+	}
+	flag.CommandLine.VisitAll(func(f *flag.Flag) {
+		flags.Var(f.Value, f.Name, f.Usage)
+	})
+	return flags
+}
+
+// runCollect runs the enabled collectors and writes the exposition to the output file.
+// It returns the process exit code, which is non-zero if any collection failed.
+func runCollect() int {
+	for {
+		err := collectOnceToOutput(context.Background())
+		if *collectOnce {
+			if err != nil {
+				log.Printf("Collection failed: %v", err)
+				return 1
+			}
+			return 0
+		}
+		if err != nil {
+			log.Printf("Collection failed: %v", err)
+		}
+		time.Sleep(*collectInterval)
+	}
+}
+
+// collectOnceToOutput runs a single collection and writes the result, reporting any API errors
+func collectOnceToOutput(ctx context.Context) error {
+	errorsBefore := appmetrics.ApiErrorsCounter.Get()
+	collector.Collect(ctx)
+
+	var buf bytes.Buffer
+	if err := exposition.Write(&buf, false); err != nil {
+		return err
+	}
+	if err := writeOutput(*collectOutput, buf.Bytes()); err != nil {
+		return err
+	}
+
+	if errors := appmetrics.ApiErrorsCounter.Get() - errorsBefore; errors > 0 {
+		return fmt.Errorf("%d API errors during collection", errors)
+	}
+	return nil
+}
+
+// writeOutput writes data to stdout or atomically replaces the file at path
+func writeOutput(path string, data []byte) error {
+	if path == "" || path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+
+	// Write to a temporary file in the same directory and rename it into place so
+	// readers such as the node_exporter textfile collector never see a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
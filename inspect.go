@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/cloudflare/cloudflare-go"
+	"github.com/vinistoisr/zerotrust-exporter/internal/devices"
+	"github.com/vinistoisr/zerotrust-exporter/internal/dex"
+	"github.com/vinistoisr/zerotrust-exporter/internal/tunnels"
+	"github.com/vinistoisr/zerotrust-exporter/internal/users"
+)
+
+// Flags for the inventory inspection subcommands, only accepted after the devices, tunnels, dex and users commands
+var (
+	inspectFlags    = flag.NewFlagSet("inspect", flag.ExitOnError)
+	inspectFormat   = inspectFlags.String("format", "table", "devices/tunnels/dex/users: output format, table or json")
+	inspectStatus   = inspectFlags.String("status", "", "devices/tunnels: only show entries with this status")
+	inspectPlatform = inspectFlags.String("platform", "", "devices: only show devices on this platform")
+	inspectColo     = inspectFlags.String("colo", "", "devices/tunnels: only show entries connected to this colo")
+	inspectKind     = inspectFlags.String("kind", "", "dex: only show tests of this kind (http or traceroute)")
+)
+
+// runInspect prints the inventory for the given command and returns the process exit code
+func runInspect(command, subcommand string) int {
+	if *inspectFormat != "table" && *inspectFormat != "json" {
+		fmt.Printf("Unknown format %q, expected table or json\n", *inspectFormat)
+		return 1
+	}
+	ctx := context.Background()
+	var err error
+	switch command + " " + subcommand {
+	case "devices list":
+		err = listDevices(ctx)
+	case "tunnels list":
+		err = listTunnels(ctx)
+	case "dex tests":
+		err = listDexTests(ctx)
+	case "users list":
+		err = listUsers(ctx)
+	default:
+		fmt.Printf("Unknown command %q, expected one of: devices list, tunnels list, dex tests, users list\n", strings.TrimSpace(command+" "+subcommand))
+		return 1
+	}
+	if err != nil {
+		log.Printf("Error running %s %s: %v", command, subcommand, err)
+		return 1
+	}
+	return 0
+}
+
+// listDevices prints devices from the DEX fleet status API
+func listDevices(ctx context.Context) error {
+	deviceStatuses, err := devices.FetchDeviceStatus(ctx, accountID, *inspectStatus)
+	if err != nil {
+		return err
+	}
+
+	var rows []devices.DeviceStatus
+	for _, device := range deviceStatuses {
+		if !matches(*inspectStatus, device.Status) || !matches(*inspectPlatform, device.Platform) || !matches(*inspectColo, device.Colo) {
+			continue
+		}
+		rows = append(rows, device)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].DeviceName < rows[j].DeviceName })
+
+	if *inspectFormat == "json" {
+		return printJSON(rows)
+	}
+	return printTable([]string{"DEVICE ID", "NAME", "USER", "STATUS", "PLATFORM", "VERSION", "MODE", "COLO", "LAST SEEN"}, len(rows), func(i int) []string {
+		d := rows[i]
+		return []string{d.DeviceID, d.DeviceName, d.PersonEmail, d.Status, d.Platform, d.Version, d.Mode, d.Colo, d.Timestamp}
+	})
+}
+
+// listTunnels prints all non-deleted tunnels
+func listTunnels(ctx context.Context) error {
+	tunnelList, err := tunnels.FetchTunnels(ctx)
+	if err != nil {
+		return err
+	}
+
+	var rows []cloudflare.Tunnel
+	for _, tunnel := range tunnelList {
+		if !matches(*inspectStatus, tunnel.Status) || (*inspectColo != "" && !containsFold(tunnelColos(tunnel), *inspectColo)) {
+			continue
+		}
+		rows = append(rows, tunnel)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Name < rows[j].Name })
+
+	if *inspectFormat == "json" {
+		return printJSON(rows)
+	}
+	return printTable([]string{"TUNNEL ID", "NAME", "STATUS", "TYPE", "CONNECTIONS", "COLOS"}, len(rows), func(i int) []string {
+		t := rows[i]
+		return []string{t.ID, t.Name, t.Status, t.TunnelType, fmt.Sprint(len(t.Connections)), strings.Join(tunnelColos(t), ",")}
+	})
+}
+
+// listDexTests prints all DEX tests with their average latency over the DEX tests window
+func listDexTests(ctx context.Context) error {
+	tests, err := dex.FetchDexTests(ctx, accountID)
+	if err != nil {
+		return err
+	}
+
+	var rows []dex.DexTests
+	for _, test := range tests {
+		if !matches(*inspectKind, test.Kind) {
+			continue
+		}
+		rows = append(rows, test)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].TestName < rows[j].TestName })
+
+	if *inspectFormat == "json" {
+		return printJSON(rows)
+	}
+	return printTable([]string{"TEST ID", "NAME", "KIND", "HOST", "INTERVAL", "ENABLED", "TARGETED", "AVG MS"}, len(rows), func(i int) []string {
+		t := rows[i]
+		avgMs := 0
+		switch {
+		case t.TracerouteResults != nil:
+			avgMs = t.TracerouteResults.RoundTripTime.AvgMs
+		case t.HTTPResults != nil:
+			avgMs = t.HTTPResults.ResourceFetchTime.AvgMs
+		}
+		return []string{t.TestID, t.TestName, t.Kind, t.Host, t.Interval, fmt.Sprint(t.Enabled), fmt.Sprint(t.Targeted), fmt.Sprint(avgMs)}
+	})
+}
+
+// listUsers prints all Access users
+func listUsers(ctx context.Context) error {
+	userMap, err := users.FetchAllUsers(ctx)
+	if err != nil {
+		return err
+	}
+
+	rows := make([]*cloudflare.AccessUser, 0, len(userMap))
+	for _, user := range userMap {
+		rows = append(rows, user)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Email < rows[j].Email })
+
+	if *inspectFormat == "json" {
+		return printJSON(rows)
+	}
+	return printTable([]string{"USER ID", "EMAIL", "NAME", "ACCESS SEAT", "GATEWAY SEAT", "DEVICES", "LAST LOGIN"}, len(rows), func(i int) []string {
+		u := rows[i]
+		return []string{u.ID, u.Email, u.Name, boolString(u.AccessSeat), boolString(u.GatewaySeat), fmt.Sprint(u.ActiveDeviceCount), u.LastSuccessfulLogin}
+	})
+}
+
+// tunnelColos returns the distinct colos a tunnel is connected to
+func tunnelColos(tunnel cloudflare.Tunnel) []string {
+	var colos []string
+	for _, conn := range tunnel.Connections {
+		if !containsFold(colos, conn.ColoName) {
+			colos = append(colos, conn.ColoName)
+		}
+	}
+	sort.Strings(colos)
+	return colos
+}
+
+// matches reports whether value matches filter, an empty filter matches everything
+func matches(filter, value string) bool {
+	return filter == "" || strings.EqualFold(filter, value)
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func boolString(b *bool) string {
+	return fmt.Sprint(b != nil && *b)
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// printTable prints rows as an aligned table with the given header
+func printTable(header []string, n int, row func(int) []string) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for i := 0; i < n; i++ {
+		fmt.Fprintln(w, strings.Join(row(i), "\t"))
+	}
+	return w.Flush()
+}
@@ -1,17 +1,24 @@
 package appmetrics
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/VictoriaMetrics/metrics"
 )
 
 // Prometheus Endpoint metrics
 var (
-	UpMetric         = metrics.NewGauge("zerotrust_exporter_up", func() float64 { return 1 })
+	UpMetric         = metrics.NewGauge("zerotrust_exporter_up", nil)
 	ScrapeDuration   = metrics.NewHistogram("zerotrust_exporter_scrape_duration_seconds")
 	ApiCallCounter   = metrics.NewCounter("zerotrust_exporter_api_calls_total")
 	ApiErrorsCounter = metrics.NewCounter("zerotrust_exporter_api_errors_total")
 )
 
+func init() {
+	UpMetric.Set(1)
+}
+
 func SetUpMetric(value float64) {
 	UpMetric.Set(value)
 }
@@ -27,3 +34,56 @@ func IncApiCallCounter() {
 func IncApiErrorsCounter() {
 	ApiErrorsCounter.Inc()
 }
+
+// Remote write metrics
+var (
+	RemoteWriteQueueLength    = metrics.NewGauge("zerotrust_exporter_remote_write_queue_length", nil)
+	RemoteWriteSamplesSent    = metrics.NewCounter("zerotrust_exporter_remote_write_samples_sent_total")
+	RemoteWriteSamplesFailed  = metrics.NewCounter("zerotrust_exporter_remote_write_samples_failed_total")
+	RemoteWriteSamplesDropped = metrics.NewCounter("zerotrust_exporter_remote_write_samples_dropped_total")
+	RemoteWriteRequests       = metrics.NewCounter("zerotrust_exporter_remote_write_requests_total")
+	RemoteWriteRetries        = metrics.NewCounter("zerotrust_exporter_remote_write_retries_total")
+	RemoteWriteSendDuration   = metrics.NewHistogram("zerotrust_exporter_remote_write_send_duration_seconds")
+)
+
+// SetApiTokenValid records the result of the token verification. The gauge is only
+// registered once a verification ran, so it is missing with Global API Key auth or verify-mode=off.
+func SetApiTokenValid(valid bool) {
+	value := 0.0
+	if valid {
+		value = 1
+	}
+	metrics.GetOrCreateGauge("zerotrust_exporter_api_token_valid", nil).Set(value)
+}
+
+// SetApiTokenExpiry records the token expiry time, tokens without an expiry are not reported
+func SetApiTokenExpiry(expiresOn time.Time) {
+	if expiresOn.IsZero() {
+		return
+	}
+	metrics.GetOrCreateGauge("zerotrust_exporter_api_token_expiry_timestamp_seconds", nil).Set(float64(expiresOn.Unix()))
+}
+
+// SetCollectorPermission records whether the API token can access a collector's endpoint
+func SetCollectorPermission(collector string, ok bool) {
+	value := 0.0
+	if ok {
+		value = 1
+	}
+	metrics.GetOrCreateGauge(fmt.Sprintf(`zerotrust_exporter_collector_permission_ok{collector="%s"}`, collector), nil).Set(value)
+}
+
+// SetSeriesCount records the number of series exported for a metric family
+func SetSeriesCount(family string, count int) {
+	metrics.GetOrCreateGauge(fmt.Sprintf(`zerotrust_exporter_series{family="%s"}`, family), nil).Set(float64(count))
+}
+
+// AddSeriesDropped counts series rejected by a metric family's series limit
+func AddSeriesDropped(family string, count int) {
+	metrics.GetOrCreateCounter(fmt.Sprintf(`zerotrust_exporter_series_dropped_total{family="%s"}`, family)).Add(count)
+}
+
+// Exposition metrics
+var (
+	InvalidExpositionLines = metrics.NewCounter("zerotrust_exporter_invalid_exposition_lines_total")
+)
@@ -2,47 +2,127 @@ package collector
 
 import (
 	"context"
+	"crypto/subtle"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/VictoriaMetrics/metrics"
+	"github.com/prometheus/exporter-toolkit/web"
 	"github.com/vinistoisr/zerotrust-exporter/internal/appmetrics"
 	"github.com/vinistoisr/zerotrust-exporter/internal/config"
 	"github.com/vinistoisr/zerotrust-exporter/internal/devices"
 	"github.com/vinistoisr/zerotrust-exporter/internal/dex"
+	"github.com/vinistoisr/zerotrust-exporter/internal/exposition"
+	"github.com/vinistoisr/zerotrust-exporter/internal/gateway"
+	"github.com/vinistoisr/zerotrust-exporter/internal/posture"
+	"github.com/vinistoisr/zerotrust-exporter/internal/registrations"
 	"github.com/vinistoisr/zerotrust-exporter/internal/tunnels"
 	"github.com/vinistoisr/zerotrust-exporter/internal/users"
+	"github.com/vinistoisr/zerotrust-exporter/internal/verify"
+	"gopkg.in/yaml.v2"
 )
 
 // Register metrics handler
 func RegisterHandler() {
+	if config.WebBearerTokenFile != "" {
+		http.HandleFunc("/metrics", requireBearerToken(MetricsHandler))
+		return
+	}
 	http.HandleFunc("/metrics", MetricsHandler)
 }
 
-// StartServer starts the HTTP server
+// StartServer starts the HTTP server, using the exporter-toolkit web config file for TLS and basic auth if set
 func StartServer(addr string) {
-	if err := http.ListenAndServe(addr, nil); err != nil {
+	server := &http.Server{}
+	flags := &web.FlagConfig{
+		WebListenAddresses: &[]string{addr},
+		WebConfigFile:      &config.WebConfigFile,
+	}
+	if err := web.ListenAndServe(server, flags, slog.Default()); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
 
+// HasBasicAuthUsers reports whether the web config file enables basic auth. Basic auth and
+// the bearer token both need the Authorization header, so they cannot be used together.
+func HasBasicAuthUsers(webConfigFile string) (bool, error) {
+	data, err := os.ReadFile(webConfigFile)
+	if err != nil {
+		return false, err
+	}
+	var webConfig struct {
+		Users map[string]string `yaml:"basic_auth_users"`
+	}
+	if err := yaml.Unmarshal(data, &webConfig); err != nil {
+		return false, err
+	}
+	return len(webConfig.Users) > 0, nil
+}
+
+// requireBearerToken rejects requests that do not carry the token from WebBearerTokenFile.
+// The file is read on every request so a rotated token applies immediately.
+func requireBearerToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		data, err := os.ReadFile(config.WebBearerTokenFile)
+		if err != nil {
+			log.Printf("Error reading bearer token file: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		token := strings.TrimSpace(string(data))
+		provided, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, req)
+	}
+}
+
 // metricsHandler handles the /metrics endpoint
 func MetricsHandler(w http.ResponseWriter, req *http.Request) {
+	// Start timer for debug output
+	startTime := time.Now()
+	Collect(req.Context())
+
+	// Write metrics to the response
+	if err := exposition.Write(w, true); err != nil {
+		log.Printf("Error writing metrics: %v", err)
+		http.Error(w, "Error writing metrics", http.StatusInternalServerError)
+		return
+	}
+
+	// Print debug information if enabled
+	if config.Debug {
+		log.Printf("Scrape completed in %v", time.Since(startTime))
+		log.Printf("API calls made: %d", appmetrics.ApiCallCounter.Get())
+		log.Printf("API errors encountered: %d", appmetrics.ApiErrorsCounter.Get())
+	}
+}
+
+// Collect runs all enabled collectors and waits for them to complete
+func Collect(ctx context.Context) {
 	// Start timer for scrape duration
 	startTime := time.Now()
-	// create a channel between device metrics and user metrics
-	deviceMetricsChan := make(chan map[string]devices.DeviceStatus)
+	// Reset up status, collectors set it to 0 on errors
+	appmetrics.SetUpMetric(1)
+	// create a channel between device metrics and user metrics, buffered so
+	// the device collector never blocks when user metrics are disabled
+	deviceMetricsChan := make(chan map[string]devices.DeviceStatus, 1)
 
 	// Create a wait group to wait for all goroutines to complete
 	var wg sync.WaitGroup
-	wg.Add(4)
+	wg.Add(11)
 
 	// GO Collect device metrics
 	go func() {
 		defer wg.Done()
-		if config.EnableDevices {
+		if config.EnableDevices && verify.Allowed("devices") {
 			log.Println("Collecting device metrics...")
 			deviceMetrics := devices.CollectDeviceMetrics()
 			deviceMetricsChan <- deviceMetrics
@@ -55,7 +135,7 @@ func MetricsHandler(w http.ResponseWriter, req *http.Request) {
 	// GO Collect user metrics
 	go func() {
 		defer wg.Done()
-		if config.EnableUsers {
+		if config.EnableUsers && verify.Allowed("users") {
 			log.Println("Waiting for device metrics...")
 			deviceMetrics, ok := <-deviceMetricsChan
 			if ok {
@@ -69,7 +149,7 @@ func MetricsHandler(w http.ResponseWriter, req *http.Request) {
 	// GO Collect tunnel metrics
 	go func() {
 		defer wg.Done()
-		if config.EnableTunnels {
+		if config.EnableTunnels && verify.Allowed("tunnels") {
 			log.Println("Collecting tunnel metrics...")
 			tunnels.CollectTunnelMetrics()
 		}
@@ -78,9 +158,72 @@ func MetricsHandler(w http.ResponseWriter, req *http.Request) {
 	// Go Collect dex metrics
 	go func() {
 		defer wg.Done()
-		if config.EnableDex {
+		if config.EnableDex && verify.Allowed("dex") {
 			log.Println("Collecting dex metrics...")
-			dex.CollectDexMetrics(context.TODO(), config.AccountID)
+			dex.CollectDexMetrics(ctx, config.AccountID)
+		}
+	}()
+
+	// Go Collect dex fleet status metrics
+	go func() {
+		defer wg.Done()
+		if config.EnableFleetStatus && verify.Allowed("fleet") {
+			log.Println("Collecting fleet status metrics...")
+			dex.CollectFleetStatusMetrics(ctx, config.AccountID)
+		}
+	}()
+
+	// Go Collect dex command metrics
+	go func() {
+		defer wg.Done()
+		if config.EnableDexCommands && verify.Allowed("commands") {
+			log.Println("Collecting dex command metrics...")
+			dex.CollectCommandMetrics(ctx, config.AccountID)
+		}
+	}()
+
+	// Go Collect registered device metrics
+	go func() {
+		defer wg.Done()
+		if config.EnableRegistrations && verify.Allowed("registrations") {
+			log.Println("Collecting registration metrics...")
+			registrations.CollectRegistrationMetrics(ctx)
+		}
+	}()
+
+	// Go Collect device posture metrics
+	go func() {
+		defer wg.Done()
+		if config.EnablePosture && verify.Allowed("posture") {
+			log.Println("Collecting posture metrics...")
+			posture.CollectPostureMetrics(ctx)
+		}
+	}()
+
+	// Go Collect gateway dns metrics
+	go func() {
+		defer wg.Done()
+		if config.EnableGatewayDNS && verify.Allowed("gateway") {
+			log.Println("Collecting gateway dns metrics...")
+			gateway.CollectDNSMetrics(ctx)
+		}
+	}()
+
+	// Go Collect gateway http metrics
+	go func() {
+		defer wg.Done()
+		if config.EnableGatewayHTTP && verify.Allowed("gateway") {
+			log.Println("Collecting gateway http metrics...")
+			gateway.CollectHTTPMetrics(ctx)
+		}
+	}()
+
+	// Go Collect gateway network metrics
+	go func() {
+		defer wg.Done()
+		if config.EnableGatewayNetwork && verify.Allowed("gateway") {
+			log.Println("Collecting gateway network metrics...")
+			gateway.CollectNetworkMetrics(ctx)
 		}
 	}()
 
@@ -91,13 +234,4 @@ func MetricsHandler(w http.ResponseWriter, req *http.Request) {
 
 	// Update scrape duration metric
 	appmetrics.ScrapeDuration.UpdateDuration(startTime)
-	// Write metrics to the response
-	metrics.WritePrometheus(w, true)
-
-	// Print debug information if enabled
-	if config.Debug {
-		log.Printf("Scrape completed in %v", time.Since(startTime))
-		log.Printf("API calls made: %d", appmetrics.ApiCallCounter.Get())
-		log.Printf("API errors encountered: %d", appmetrics.ApiErrorsCounter.Get())
-	}
 }
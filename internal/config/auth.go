@@ -0,0 +1,106 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// Authentication settings
+var (
+	ApiKeyFile string
+	ApiEmail   string
+	authMu     sync.RWMutex
+)
+
+// NewClient creates a Cloudflare client for apiKey, using Global API Key
+// authentication when ApiEmail is set and API token authentication otherwise
+func NewClient(apiKey string) (*cloudflare.API, error) {
+	if ApiEmail != "" {
+		return cloudflare.New(apiKey, ApiEmail)
+	}
+	return cloudflare.NewWithAPIToken(apiKey)
+}
+
+// GetClient returns the current Cloudflare client
+func GetClient() *cloudflare.API {
+	authMu.RLock()
+	defer authMu.RUnlock()
+	return Client
+}
+
+// SetAuthHeaders adds the current credentials to a raw API request
+func SetAuthHeaders(req *http.Request) {
+	authMu.RLock()
+	apiKey := ApiKey
+	authMu.RUnlock()
+
+	if ApiEmail != "" {
+		req.Header.Set("X-Auth-Email", ApiEmail)
+		req.Header.Set("X-Auth-Key", apiKey)
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+}
+
+// ReadApiKeyFile reads an API key from a file such as a Kubernetes or Docker secret
+func ReadApiKeyFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	apiKey := strings.TrimSpace(string(data))
+	if apiKey == "" {
+		return "", fmt.Errorf("API key file %s is empty", path)
+	}
+	return apiKey, nil
+}
+
+// WatchApiKeyFile re-reads ApiKeyFile every interval and swaps in a new client when the key is rotated
+func WatchApiKeyFile(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := reloadApiKey(); err != nil {
+				log.Printf("Error reloading API key from %s: %v", ApiKeyFile, err)
+			}
+		}
+	}
+}
+
+// reloadApiKey reads ApiKeyFile and replaces the key and client if it changed
+func reloadApiKey() error {
+	apiKey, err := ReadApiKeyFile(ApiKeyFile)
+	if err != nil {
+		return err
+	}
+
+	authMu.RLock()
+	unchanged := apiKey == ApiKey
+	authMu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	client, err := NewClient(apiKey)
+	if err != nil {
+		return err
+	}
+	authMu.Lock()
+	ApiKey = apiKey
+	Client = client
+	authMu.Unlock()
+	log.Printf("Reloaded rotated API key from %s", ApiKeyFile)
+	return nil
+}
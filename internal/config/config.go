@@ -1,6 +1,10 @@
 package config
 
-import "github.com/cloudflare/cloudflare-go"
+import (
+	"time"
+
+	"github.com/cloudflare/cloudflare-go"
+)
 
 var (
 	ApiKey        string
@@ -10,9 +14,116 @@ var (
 	EnableUsers   bool
 	EnableTunnels bool
 	EnableDex     bool
+	DisableHTTP   bool
 	Client        *cloudflare.API
 )
 
+// Devices collector settings
+var (
+	DevicesAggregateOnly bool
+	DevicesLookback      time.Duration
+	WarpMinVersions      map[string]string
+)
+
+// DEX query window settings
+var (
+	DexTestsWindow      time.Duration
+	DexTracerouteWindow time.Duration
+)
+
+// DEX per-device results settings
+var (
+	DexDevices    []string
+	DexDevicesMax int
+)
+
+// DEX network path settings
+var (
+	DexNetworkPathTests   []string
+	DexNetworkPathDevices []string
+)
+
+// DEX commands collector settings
+var (
+	EnableDexCommands bool
+	DexCommandsWindow time.Duration
+)
+
+// DEX fleet status collector settings
+var (
+	EnableFleetStatus bool
+	FleetStatusWindow time.Duration
+)
+
+// Gateway analytics collector settings
+var (
+	EnableGatewayDNS     bool
+	EnableGatewayHTTP    bool
+	EnableGatewayNetwork bool
+	GatewayWindow        time.Duration
+	GatewayDelay         time.Duration
+	GraphQLEndpoint      string
+)
+
+// Registered devices collector settings
+var (
+	EnableRegistrations     bool
+	RegistrationsStaleAfter time.Duration
+)
+
+// Device posture collector settings
+var (
+	EnablePosture     bool
+	PostureMaxDevices int
+)
+
+// Web server settings
+var (
+	WebConfigFile      string
+	WebBearerTokenFile string
+)
+
+// Label redaction settings
+var (
+	RedactLabels map[string]string
+	RedactKey    []byte
+)
+
+// Cardinality limit settings
+var (
+	SeriesLimit       int
+	SeriesLimits      map[string]int
+	SeriesLimitAction string
+)
+
+// Remote write settings
+var (
+	RemoteWriteURL         string
+	RemoteWriteInterval    time.Duration
+	RemoteWriteTimeout     time.Duration
+	RemoteWriteBatchSize   int
+	RemoteWriteQueueSize   int
+	RemoteWriteMaxRetries  int
+	RemoteWriteUsername    string
+	RemoteWritePassword    string
+	RemoteWriteBearerToken string
+)
+
+// OTLP export settings
+var (
+	OTLPProtocol string
+	OTLPEndpoint string
+	OTLPHeaders  string
+	OTLPInterval time.Duration
+	OTLPTimeout  time.Duration
+)
+
+// Token verification settings
+var (
+	VerifyMode     string
+	VerifyInterval time.Duration
+)
+
 func InitConfig(apiKey, accountID string, debug, enableDevices, enableUsers, enableTunnels, enableDex bool, client *cloudflare.API) {
 	ApiKey = apiKey
 	AccountID = accountID
@@ -0,0 +1,35 @@
+package devices
+
+import (
+	"fmt"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/vinistoisr/zerotrust-exporter/internal/gauges"
+)
+
+// aggregates lists the fleet level metric families and the device field each one groups by
+var aggregates = []struct {
+	family string
+	label  string
+	value  func(DeviceStatus) string
+}{
+	{"zerotrust_devices_connected_by_platform", "platform", func(d DeviceStatus) string { return d.Platform }},
+	{"zerotrust_devices_connected_by_version", "version", func(d DeviceStatus) string { return d.Version }},
+	{"zerotrust_devices_connected_by_mode", "mode", func(d DeviceStatus) string { return d.Mode }},
+	{"zerotrust_devices_connected_by_colo", "colo", func(d DeviceStatus) string { return d.Colo }},
+}
+
+// aggregateGauges holds the per-value counts, removed when no connected device has the value any more
+var aggregateGauges = gauges.Group{Remove: true}
+
+// updateAggregates sets the low cardinality fleet gauges from the connected devices
+func updateAggregates(devices map[string]DeviceStatus) {
+	counts := make(map[string]float64)
+	for _, device := range devices {
+		for _, a := range aggregates {
+			counts[fmt.Sprintf(`%s{%s="%s"}`, a.family, a.label, a.value(device))]++
+		}
+	}
+	aggregateGauges.Update(counts)
+	metrics.GetOrCreateGauge("zerotrust_devices_connected", nil).Set(float64(len(devices)))
+}
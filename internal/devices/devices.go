@@ -14,6 +14,13 @@ import (
 	"github.com/vinistoisr/zerotrust-exporter/internal/config"
 )
 
+// perPage is the page size used when listing devices
+const perPage = 50
+
+// connectedWithin is how recent a device's latest check-in must be for it to count as up,
+// independent of how far back DevicesLookback fetches check-ins
+const connectedWithin = 10 * time.Minute
+
 type DeviceStatus struct {
 	Colo        string `json:"colo"`
 	Mode        string `json:"mode"`
@@ -26,33 +33,83 @@ type DeviceStatus struct {
 	PersonEmail string `json:"personEmail"`
 }
 
-func fetchDeviceStatus(ctx context.Context, accountID string) (map[string]DeviceStatus, error) {
+// FetchDeviceStatus fetches devices seen within the lookback window from the DEX fleet status API, optionally filtered by status
+func FetchDeviceStatus(ctx context.Context, accountID string, status string) (map[string]DeviceStatus, error) {
+	deviceStatuses := make(map[string]DeviceStatus)
+	timeEnd := time.Now()
+	for page := 1; ; page++ {
+		devices, more, err := fetchDeviceStatusPage(ctx, accountID, status, page, timeEnd)
+		if err != nil {
+			return nil, err
+		}
+		for _, deviceStatus := range devices {
+			// Keep only the latest record of each device
+			if previous, ok := deviceStatuses[deviceStatus.DeviceID]; ok && !seenAfter(deviceStatus, previous) {
+				continue
+			}
+			deviceStatuses[deviceStatus.DeviceID] = deviceStatus
+		}
+		if !more {
+			break
+		}
+	}
+	return deviceStatuses, nil
+}
+
+// seenAt returns the time of a device status record
+func seenAt(device DeviceStatus) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, device.Timestamp)
+}
+
+// seenAfter reports whether status a was recorded after status b, preferring a if either time is invalid
+func seenAfter(a, b DeviceStatus) bool {
+	ta, errA := seenAt(a)
+	tb, errB := seenAt(b)
+	if errA != nil || errB != nil {
+		return true
+	}
+	return ta.After(tb)
+}
+
+// IsUp reports whether a device's latest record is connected and recent
+func IsUp(device DeviceStatus, now time.Time) bool {
+	if device.Status != "connected" {
+		return false
+	}
+	timestamp, err := seenAt(device)
+	return err == nil && now.Sub(timestamp) <= connectedWithin
+}
+
+// fetchDeviceStatusPage fetches a single page of device statuses and reports whether more pages follow
+func fetchDeviceStatusPage(ctx context.Context, accountID string, status string, page int, timeEnd time.Time) ([]DeviceStatus, bool, error) {
 	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/dex/fleet-status/devices", accountID)
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		log.Printf("Error creating request: %v", err)
 		appmetrics.IncApiErrorsCounter()
 		appmetrics.SetUpMetric(0)
-		return nil, err
+		return nil, false, err
 	}
 	// add authorization headers
-	req.Header.Set("Authorization", "Bearer "+config.ApiKey)
+	config.SetAuthHeaders(req)
 	req.Header.Set("Content-Type", "application/json")
 	// define query parameters
 	q := req.URL.Query()
-	q.Add("per_page", "50")
-	q.Add("page", "1")
-	q.Add("time_end", time.Unix(time.Now().Unix(), 0).Format(time.RFC3339))
-	q.Add("time_start", time.Unix(time.Now().Add(-time.Minute*10).Unix(), 0).Format(time.RFC3339))
+	q.Add("per_page", fmt.Sprintf("%d", perPage))
+	q.Add("page", fmt.Sprintf("%d", page))
+	q.Add("time_end", time.Unix(timeEnd.Unix(), 0).Format(time.RFC3339))
+	q.Add("time_start", time.Unix(timeEnd.Add(-config.DevicesLookback).Unix(), 0).Format(time.RFC3339))
 	q.Add("sort_by", "device_id")
-	q.Add("status", "connected")
+	if status != "" {
+		q.Add("status", status)
+	}
 	q.Add("source", "last_seen")
 	// add query parameters to the request
 	req.URL.RawQuery = q.Encode()
 	// send the request
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 	// defer closing the response body
 	defer resp.Body.Close()
@@ -62,24 +119,23 @@ func fetchDeviceStatus(ctx context.Context, accountID string) (map[string]Device
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
 		bodyString := string(bodyBytes)
-		return nil, fmt.Errorf("failed to fetch device status: %s, response body: %s", resp.Status, bodyString)
+		return nil, false, fmt.Errorf("failed to fetch device status: %s, response body: %s", resp.Status, bodyString)
 	}
 	// parse the response body into a struct
 	var response struct {
-		Result []DeviceStatus `json:"result"`
+		Result     []DeviceStatus `json:"result"`
+		ResultInfo struct {
+			TotalCount int `json:"total_count"`
+		} `json:"result_info"`
 	}
 	// decode the response body
 	err = json.NewDecoder(resp.Body).Decode(&response)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	deviceStatuses := make(map[string]DeviceStatus)
-	for _, deviceStatus := range response.Result {
-		deviceStatuses[deviceStatus.DeviceID] = deviceStatus
-	}
-
-	return deviceStatuses, nil
+	more := len(response.Result) == perPage && page*perPage < response.ResultInfo.TotalCount
+	return response.Result, more, nil
 }
 
 func CollectDeviceMetrics() map[string]DeviceStatus {
@@ -87,7 +143,8 @@ func CollectDeviceMetrics() map[string]DeviceStatus {
 	ctx := context.Background()
 	startTime := time.Now()
 
-	deviceStatuses, err := fetchDeviceStatus(ctx, config.AccountID)
+	// Fetch devices in any status so devices that stopped checking in keep their last seen time
+	deviceStatuses, err := FetchDeviceStatus(ctx, config.AccountID, "")
 	if err != nil {
 		log.Printf("Error fetching device status: %v", err)
 		appmetrics.IncApiErrorsCounter()
@@ -100,12 +157,21 @@ func CollectDeviceMetrics() map[string]DeviceStatus {
 	}
 
 	filteredDevices := make(map[string]DeviceStatus)
+	now := time.Now()
 	for _, status := range deviceStatuses {
-		if status.Status == "connected" {
+		if IsUp(status, now) {
 			filteredDevices[status.DeviceID] = status
 		}
 	}
 
+	updateLastSeen(deviceStatuses)
+	updateAggregates(filteredDevices)
+	updateVersionCompliance(filteredDevices)
+	if config.DevicesAggregateOnly {
+		log.Println("Device metrics collection completed.")
+		return filteredDevices
+	}
+
 	for deviceID, status := range filteredDevices {
 		metricName := fmt.Sprintf(`zerotrust_devices_up{device_id="%s", device_name="%s", user_email="%s", colo="%s", mode="%s", platform="%s", version="%s"}`, deviceID, status.DeviceName, status.PersonEmail, status.Colo, status.Mode, status.Platform, status.Version)
 		gauge := metrics.GetOrCreateGauge(metricName, nil)
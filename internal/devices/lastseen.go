@@ -0,0 +1,64 @@
+package devices
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/vinistoisr/zerotrust-exporter/internal/config"
+	"github.com/vinistoisr/zerotrust-exporter/internal/gauges"
+)
+
+// lastSeenBuckets are the upper bounds in seconds of the last seen age distribution
+var lastSeenBuckets = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute, time.Hour, 6 * time.Hour, 24 * time.Hour, 7 * 24 * time.Hour}
+
+var (
+	// lastSeenGauges are removed when a device is no longer seen within the lookback window
+	lastSeenGauges = gauges.Group{Remove: true}
+	ageGauges      gauges.Group
+)
+
+// ageBucket returns the gauge counting devices last seen within bound, or within any time if bound is 0
+func ageBucket(bound time.Duration) string {
+	le := "+Inf"
+	if bound > 0 {
+		le = strconv.FormatFloat(bound.Seconds(), 'f', -1, 64)
+	}
+	return fmt.Sprintf(`zerotrust_devices_last_seen_within{le="%s"}`, le)
+}
+
+// updateLastSeen exports when each device was last seen and the fleet wide age distribution.
+// The distribution is a set of gauges counting the devices last seen at most le seconds ago.
+func updateLastSeen(devices map[string]DeviceStatus) {
+	now := time.Now()
+	ages := make(map[string]float64)
+	for _, bound := range lastSeenBuckets {
+		ages[ageBucket(bound)] = 0
+	}
+	ages[ageBucket(0)] = 0
+
+	lastSeen := make(map[string]float64)
+	for deviceID, device := range devices {
+		timestamp, err := seenAt(device)
+		if err != nil {
+			if config.Debug {
+				log.Printf("Error parsing last seen time %q for device %s: %v", device.Timestamp, deviceID, err)
+			}
+			continue
+		}
+		age := now.Sub(timestamp)
+		for _, bound := range lastSeenBuckets {
+			if age <= bound {
+				ages[ageBucket(bound)]++
+			}
+		}
+		ages[ageBucket(0)]++
+
+		if !config.DevicesAggregateOnly {
+			lastSeen[fmt.Sprintf(`zerotrust_device_last_seen_timestamp_seconds{device_id="%s"}`, deviceID)] = float64(timestamp.Unix())
+		}
+	}
+	ageGauges.Update(ages)
+	lastSeenGauges.Update(lastSeen)
+}
@@ -0,0 +1,136 @@
+package devices
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/vinistoisr/zerotrust-exporter/internal/config"
+	"github.com/vinistoisr/zerotrust-exporter/internal/gauges"
+)
+
+// defaultPlatform is the version policy key applied to platforms without their own minimum
+const defaultPlatform = "default"
+
+// ParseVersionPolicy parses a comma separated list of platform=minimum_version pairs
+func ParseVersionPolicy(s string) (map[string]string, error) {
+	policy := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		platform, version, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid version policy %q, expected platform=version", pair)
+		}
+		if _, err := parseVersion(version); err != nil {
+			return nil, fmt.Errorf("invalid minimum version for platform %q: %w", platform, err)
+		}
+		policy[strings.ToLower(strings.TrimSpace(platform))] = strings.TrimSpace(version)
+	}
+	return policy, nil
+}
+
+// parseVersion splits a WARP client version such as 2024.6.415.0 or 1.2.3-beta into numeric components
+func parseVersion(version string) ([]int, error) {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if n := strings.IndexAny(version, "-+ "); n >= 0 {
+		version = version[:n]
+	}
+	if version == "" {
+		return nil, fmt.Errorf("empty version")
+	}
+	parts := strings.Split(version, ".")
+	components := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q", version)
+		}
+		components[i] = n
+	}
+	return components, nil
+}
+
+// compareVersions compares versions component by component, treating missing components as zero
+func compareVersions(a, b []int) int {
+	for i := 0; i < max(len(a), len(b)); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// minimumVersion returns the minimum version required for a platform, if any
+func minimumVersion(platform string) (string, bool) {
+	if version, ok := config.WarpMinVersions[strings.ToLower(platform)]; ok {
+		return version, true
+	}
+	version, ok := config.WarpMinVersions[defaultPlatform]
+	return version, ok
+}
+
+// isCompliant reports whether a device meets the minimum version for its platform.
+// Devices reporting a version that cannot be parsed are not compliant.
+func isCompliant(device DeviceStatus, minimum string) bool {
+	version, err := parseVersion(device.Version)
+	if err != nil {
+		return false
+	}
+	required, _ := parseVersion(minimum)
+	return compareVersions(version, required) >= 0
+}
+
+var (
+	outdatedGauges gauges.Group
+	// compliantGauges are removed when a device disappears or its version or minimum changes
+	compliantGauges = gauges.Group{Remove: true}
+)
+
+// updateVersionCompliance exports the outdated device counts and per-device compliance
+func updateVersionCompliance(devices map[string]DeviceStatus) {
+	if len(config.WarpMinVersions) == 0 {
+		return
+	}
+
+	outdated := make(map[string]float64)
+	compliance := make(map[string]float64)
+	for deviceID, device := range devices {
+		minimum, ok := minimumVersion(device.Platform)
+		if !ok {
+			continue
+		}
+		name := fmt.Sprintf(`zerotrust_devices_outdated{platform="%s"}`, device.Platform)
+		compliant := isCompliant(device, minimum)
+		// Platforms with a policy are always reported, even with no outdated devices
+		if _, ok := outdated[name]; !ok {
+			outdated[name] = 0
+		}
+		if !compliant {
+			outdated[name]++
+		}
+
+		if config.DevicesAggregateOnly {
+			continue
+		}
+		value := 0.0
+		if compliant {
+			value = 1
+		}
+		compliance[fmt.Sprintf(`zerotrust_device_version_compliant{device_id="%s", platform="%s", version="%s", minimum_version="%s"}`, deviceID, device.Platform, device.Version, minimum)] = value
+	}
+	outdatedGauges.Update(outdated)
+	compliantGauges.Update(compliance)
+}
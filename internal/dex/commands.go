@@ -0,0 +1,131 @@
+package dex
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/vinistoisr/zerotrust-exporter/internal/appmetrics"
+	"github.com/vinistoisr/zerotrust-exporter/internal/config"
+	"github.com/vinistoisr/zerotrust-exporter/internal/gauges"
+)
+
+// Command is a DEX remote capture command, such as a packet capture or WARP diagnostics
+type Command struct {
+	ID            string `json:"id"`
+	DeviceID      string `json:"device_id"`
+	UserEmail     string `json:"user_email"`
+	Type          string `json:"type"`
+	Status        string `json:"status"`
+	CreatedAt     string `json:"created_at"`
+	CompletedDate string `json:"completed_date"`
+}
+
+// CommandsQuota is the account's remote capture quota
+type CommandsQuota struct {
+	Quota      int    `json:"quota"`
+	QuotaUsage int    `json:"quota_usage"`
+	ResetTime  string `json:"reset_time"`
+}
+
+var (
+	// commandCountGauges holds the command counts per type and status
+	commandCountGauges gauges.Group
+	// commandGauges holds the per-command series, removed once a command leaves the window
+	commandGauges = gauges.Group{Remove: true}
+	// quotaGauges holds the quota of the account
+	quotaGauges gauges.Group
+)
+
+// FetchCommands fetches the DEX commands created within the commands window
+func FetchCommands(ctx context.Context, accountID string) ([]Command, error) {
+	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/dex/commands", accountID)
+	timeEnd := time.Now()
+	perPage := 50
+
+	var commands []Command
+	for page := 1; ; page++ {
+		var result struct {
+			Commands []Command `json:"commands"`
+		}
+		err := fetchResult(ctx, url, map[string]string{
+			"page":     fmt.Sprintf("%d", page),
+			"per_page": fmt.Sprintf("%d", perPage),
+			"from":     timeEnd.Add(-config.DexCommandsWindow).Format(time.RFC3339),
+			"to":       timeEnd.Format(time.RFC3339),
+		}, &result)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, result.Commands...)
+		if len(result.Commands) < perPage {
+			return commands, nil
+		}
+	}
+}
+
+// FetchCommandsQuota fetches the remote capture quota of the account
+func FetchCommandsQuota(ctx context.Context, accountID string) (CommandsQuota, error) {
+	var quota CommandsQuota
+	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/dex/commands/quota", accountID)
+	err := fetchResult(ctx, url, nil, &quota)
+	return quota, err
+}
+
+// CollectCommandMetrics collects the status of the DEX commands and the quota usage
+func CollectCommandMetrics(ctx context.Context, accountID string) {
+	startTime := time.Now()
+	commands, err := FetchCommands(ctx, accountID)
+	if err != nil {
+		log.Printf("Error fetching dex commands: %v", err)
+		appmetrics.IncApiErrorsCounter()
+		appmetrics.SetUpMetric(0)
+	} else {
+		updateCommands(commands)
+		if config.Debug {
+			log.Printf("Fetched %d dex commands in %v", len(commands), time.Since(startTime))
+		}
+	}
+
+	quota, err := FetchCommandsQuota(ctx, accountID)
+	if err != nil {
+		log.Printf("Error fetching dex commands quota: %v", err)
+		appmetrics.IncApiErrorsCounter()
+		appmetrics.SetUpMetric(0)
+		return
+	}
+	values := map[string]float64{
+		"zerotrust_dex_commands_quota":       float64(quota.Quota),
+		"zerotrust_dex_commands_quota_usage": float64(quota.QuotaUsage),
+	}
+	if reset, err := time.Parse(time.RFC3339Nano, quota.ResetTime); err == nil {
+		values["zerotrust_dex_commands_quota_reset_timestamp_seconds"] = float64(reset.Unix())
+	}
+	quotaGauges.Update(values)
+}
+
+// updateCommands exports the command counts and the duration of finished or age of pending commands
+func updateCommands(commands []Command) {
+	now := time.Now()
+	counts := make(map[string]float64)
+	perCommand := make(map[string]float64)
+	for _, command := range commands {
+		status := strings.ToLower(command.Status)
+		counts[fmt.Sprintf(`zerotrust_dex_commands{type="%s", status="%s"}`, command.Type, status)]++
+
+		created, err := time.Parse(time.RFC3339Nano, command.CreatedAt)
+		if err != nil {
+			continue
+		}
+		labels := fmt.Sprintf(`command_id="%s", type="%s", status="%s", device_id="%s"`, command.ID, command.Type, status, command.DeviceID)
+		if completed, err := time.Parse(time.RFC3339Nano, command.CompletedDate); err == nil {
+			perCommand[fmt.Sprintf(`zerotrust_dex_command_duration_seconds{%s}`, labels)] = completed.Sub(created).Seconds()
+		} else {
+			perCommand[fmt.Sprintf(`zerotrust_dex_command_age_seconds{%s}`, labels)] = now.Sub(created).Seconds()
+		}
+	}
+	commandCountGauges.Update(counts)
+	commandGauges.Update(perCommand)
+}
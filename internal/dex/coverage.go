@@ -0,0 +1,91 @@
+package dex
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/vinistoisr/zerotrust-exporter/internal/appmetrics"
+	"github.com/vinistoisr/zerotrust-exporter/internal/config"
+	"github.com/vinistoisr/zerotrust-exporter/internal/exposition"
+	"github.com/vinistoisr/zerotrust-exporter/internal/gauges"
+)
+
+// coverageGauges holds the per-test coverage, removed when a test is deleted
+var coverageGauges = gauges.Group{Remove: true}
+
+// coverage collects the unique devices of each test found during a single collection
+type coverage struct {
+	mu     sync.Mutex
+	unique map[string]int
+}
+
+func newCoverage() *coverage {
+	return &coverage{unique: make(map[string]int)}
+}
+
+// add records the unique devices a test ran on
+func (c *coverage) add(testID, testName, kind string, uniqueDevices int) {
+	labels := fmt.Sprintf(`test_id="%s", test_name="%s", kind="%s"`, testID, exposition.EscapeLabelValue(testName), kind)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.unique[labels] = uniqueDevices
+}
+
+// update exports the unique devices of each test and the share of the devices seen within the
+// same window they represent. The ratio is left out if the seen devices cannot be fetched.
+func (c *coverage) update(ctx context.Context, accountID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var live FleetStatusLive
+	err := fetchLive(ctx, accountID, config.DexTracerouteWindow, &live)
+	if err != nil {
+		log.Printf("Error fetching devices seen for dex test coverage: %v", err)
+		appmetrics.IncApiErrorsCounter()
+		appmetrics.SetUpMetric(0)
+	}
+	seen := live.DeviceStats.UniqueDevicesTotal
+
+	values := make(map[string]float64)
+	for labels, unique := range c.unique {
+		values[fmt.Sprintf(`zerotrust_dex_test_unique_devices{%s}`, labels)] = float64(unique)
+		if err == nil && seen > 0 {
+			values[fmt.Sprintf(`zerotrust_dex_test_coverage_ratio{%s}`, labels)] = float64(unique) / float64(seen)
+		}
+	}
+	coverageGauges.Update(values)
+}
+
+// CollectHTTPTestMetrics fetches the details of each HTTP test and records its device coverage
+func CollectHTTPTestMetrics(ctx context.Context, accountID string, tests map[string]DexTests, cov *coverage) {
+	startTime := time.Now()
+	timeEnd := time.Now()
+	count := 0
+	for _, test := range tests {
+		if test.Kind != "http" {
+			continue
+		}
+		var result HTTPTestResult
+		url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/dex/http-tests/%s", accountID, test.TestID)
+		err := fetchResult(ctx, url, map[string]string{
+			"timeStart": timeEnd.Add(-config.DexTracerouteWindow).Format(time.RFC3339),
+			"timeEnd":   timeEnd.Format(time.RFC3339),
+			"interval":  "hour",
+		}, &result)
+		if err != nil {
+			log.Printf("Error fetching http test %s: %v", test.TestID, err)
+			appmetrics.IncApiErrorsCounter()
+			appmetrics.SetUpMetric(0)
+			continue
+		}
+		cov.add(test.TestID, test.TestName, test.Kind, result.HTTPStats.UniqueDevicesTotal)
+		count++
+	}
+
+	if config.Debug {
+		log.Printf("Fetched %d http test details in %v", count, time.Since(startTime))
+	}
+}
@@ -0,0 +1,158 @@
+package dex
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/vinistoisr/zerotrust-exporter/internal/appmetrics"
+	"github.com/vinistoisr/zerotrust-exporter/internal/config"
+	"github.com/vinistoisr/zerotrust-exporter/internal/exposition"
+	"github.com/vinistoisr/zerotrust-exporter/internal/gauges"
+	"github.com/vinistoisr/zerotrust-exporter/internal/registrations"
+)
+
+// Stat is the min, average and max of a DEX test measurement
+type Stat struct {
+	Min float64 `json:"min"`
+	Avg float64 `json:"avg"`
+	Max float64 `json:"max"`
+}
+
+// HTTPTestResult represents the result of an HTTP test details request
+type HTTPTestResult struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	HTTPStats struct {
+		AvailabilityPct      Stat `json:"availabilityPct"`
+		DNSResponseTimeMs    Stat `json:"dnsResponseTimeMs"`
+		ResourceFetchTimeMs  Stat `json:"resourceFetchTimeMs"`
+		ServerResponseTimeMs Stat `json:"serverResponseTimeMs"`
+		UniqueDevicesTotal   int  `json:"uniqueDevicesTotal"`
+	} `json:"httpStats"`
+}
+
+// deviceGauges holds the per-device test series, removed when a device leaves the allowlist
+var deviceGauges = gauges.Group{Remove: true}
+
+// resolveDevices maps the configured device IDs and user emails to at most DexDevicesMax device IDs
+func resolveDevices(ctx context.Context) ([]string, error) {
+	var deviceIDs, emails []string
+	for _, entry := range config.DexDevices {
+		if strings.Contains(entry, "@") {
+			emails = append(emails, strings.ToLower(entry))
+		} else {
+			deviceIDs = append(deviceIDs, entry)
+		}
+	}
+
+	if len(emails) > 0 {
+		appmetrics.IncApiCallCounter()
+		devices, err := registrations.FetchRegistrations(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving device emails: %w", err)
+		}
+		for _, device := range devices {
+			if device.Deleted || device.RevokedAt != "" {
+				continue
+			}
+			for _, email := range emails {
+				if strings.ToLower(device.User.Email) == email {
+					deviceIDs = append(deviceIDs, device.ID)
+				}
+			}
+		}
+	}
+
+	// A device may be listed by ID and by its user's email, fetch it once
+	seen := make(map[string]bool, len(deviceIDs))
+	unique := deviceIDs[:0]
+	for _, deviceID := range deviceIDs {
+		if !seen[deviceID] {
+			seen[deviceID] = true
+			unique = append(unique, deviceID)
+		}
+	}
+	deviceIDs = unique
+
+	if len(deviceIDs) > config.DexDevicesMax {
+		log.Printf("Only collecting per-device DEX results for %d of %d devices", config.DexDevicesMax, len(deviceIDs))
+		deviceIDs = deviceIDs[:config.DexDevicesMax]
+	}
+	return deviceIDs, nil
+}
+
+// CollectDeviceTestMetrics exports the DEX test results of the allowlisted devices
+func CollectDeviceTestMetrics(ctx context.Context, accountID string) {
+	startTime := time.Now()
+	deviceIDs, err := resolveDevices(ctx)
+	if err != nil {
+		log.Printf("Error collecting per-device dex metrics: %v", err)
+		appmetrics.IncApiErrorsCounter()
+		appmetrics.SetUpMetric(0)
+		return
+	}
+
+	values := make(map[string]float64)
+	for _, deviceID := range deviceIDs {
+		tests, err := FetchDexTests(ctx, accountID, deviceID)
+		if err != nil {
+			log.Printf("Error fetching dex tests for device %s: %v", deviceID, err)
+			appmetrics.IncApiErrorsCounter()
+			appmetrics.SetUpMetric(0)
+			continue
+		}
+		for _, test := range tests {
+			labels := fmt.Sprintf(`device_id="%s", test_id="%s", test_name="%s", kind="%s"`, deviceID, test.TestID, exposition.EscapeLabelValue(test.TestName), test.Kind)
+			if err := collectDeviceTest(ctx, accountID, deviceID, test, labels, values); err != nil {
+				log.Printf("Error fetching %s test %s for device %s: %v", test.Kind, test.TestID, deviceID, err)
+				appmetrics.IncApiErrorsCounter()
+				appmetrics.SetUpMetric(0)
+			}
+		}
+	}
+	deviceGauges.Update(values)
+
+	if config.Debug {
+		log.Printf("Fetched dex results for %d devices in %v", len(deviceIDs), time.Since(startTime))
+	}
+}
+
+// collectDeviceTest adds the results of a single test on a device to values
+func collectDeviceTest(ctx context.Context, accountID, deviceID string, test DexTests, labels string, values map[string]float64) error {
+	timeEnd := time.Now()
+	query := map[string]string{
+		"deviceId":  deviceID,
+		"timeStart": timeEnd.Add(-config.DexTracerouteWindow).Format(time.RFC3339),
+		"timeEnd":   timeEnd.Format(time.RFC3339),
+		"interval":  "hour",
+	}
+
+	switch test.Kind {
+	case "traceroute":
+		var result TracerouteTestResult
+		url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/dex/traceroute-tests/%s", accountID, test.TestID)
+		if err := fetchResult(ctx, url, query, &result); err != nil {
+			return err
+		}
+		stats := result.TracerouteStats
+		values[fmt.Sprintf(`zerotrust_dex_device_traceroute_rtt_ms{%s}`, labels)] = stats.RoundTripTimeMs.Avg
+		values[fmt.Sprintf(`zerotrust_dex_device_traceroute_hops{%s}`, labels)] = stats.HopsCount.Avg
+		values[fmt.Sprintf(`zerotrust_dex_device_traceroute_packet_loss_pct{%s}`, labels)] = stats.PacketLossPct.Avg
+		values[fmt.Sprintf(`zerotrust_dex_device_traceroute_availability_pct{%s}`, labels)] = stats.AvailabilityPct.Avg
+	case "http":
+		var result HTTPTestResult
+		url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/dex/http-tests/%s", accountID, test.TestID)
+		if err := fetchResult(ctx, url, query, &result); err != nil {
+			return err
+		}
+		stats := result.HTTPStats
+		values[fmt.Sprintf(`zerotrust_dex_device_http_availability_pct{%s}`, labels)] = stats.AvailabilityPct.Avg
+		values[fmt.Sprintf(`zerotrust_dex_device_http_dns_response_time_ms{%s}`, labels)] = stats.DNSResponseTimeMs.Avg
+		values[fmt.Sprintf(`zerotrust_dex_device_http_resource_fetch_time_ms{%s}`, labels)] = stats.ResourceFetchTimeMs.Avg
+		values[fmt.Sprintf(`zerotrust_dex_device_http_server_response_time_ms{%s}`, labels)] = stats.ServerResponseTimeMs.Avg
+	}
+	return nil
+}
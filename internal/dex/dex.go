@@ -6,11 +6,14 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"sort"
+	"strings"
 	"time"
 
-	"github.com/VictoriaMetrics/metrics"
 	"github.com/vinistoisr/zerotrust-exporter/internal/appmetrics"
 	"github.com/vinistoisr/zerotrust-exporter/internal/config"
+	"github.com/vinistoisr/zerotrust-exporter/internal/exposition"
+	"github.com/vinistoisr/zerotrust-exporter/internal/gauges"
 )
 
 // Define the structs for the dex tests
@@ -37,6 +40,22 @@ type TimePeriod struct {
 	Units string `json:"units"`
 }
 
+// window formats a time period as a short window label such as 1h or 7d
+func (p TimePeriod) window() string {
+	units := map[string]string{"minutes": "m", "hours": "h", "days": "d", "weeks": "w"}
+	if unit, ok := units[p.Units]; ok {
+		return fmt.Sprintf("%d%s", p.Value, unit)
+	}
+	return fmt.Sprintf("%d%s", p.Value, p.Units)
+}
+
+var (
+	// historyGauges holds the per-test history series, removed when a test is deleted
+	historyGauges = gauges.Group{Remove: true}
+	// stateGauges holds the test counts per kind and state
+	stateGauges gauges.Group
+)
+
 type RoundTripTime struct {
 	AvgMs    int       `json:"avgMs"`
 	History  []History `json:"history"`
@@ -55,6 +74,13 @@ type HTTPResults struct {
 	} `json:"resourceFetchTime"`
 }
 
+// TargetPolicy is a device profile a DEX test is targeted at
+type TargetPolicy struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Default bool   `json:"default"`
+}
+
 type DexTests struct {
 	TestID            string             `json:"id"`
 	TestName          string             `json:"name"`
@@ -62,10 +88,23 @@ type DexTests struct {
 	Enabled           bool               `json:"enabled"`
 	Description       string             `json:"description"`
 	Host              string             `json:"host"`
+	Interval          string             `json:"interval"`
+	Targeted          bool               `json:"targeted"`
+	TargetPolicies    []TargetPolicy     `json:"target_policies"`
 	TracerouteResults *TracerouteResults `json:"tracerouteResults,omitempty"`
 	HTTPResults       *HTTPResults       `json:"httpResults,omitempty"`
 }
 
+// targetPolicyNames returns the sorted, comma separated names of the test's target policies
+func (t DexTests) targetPolicyNames() string {
+	names := make([]string, 0, len(t.TargetPolicies))
+	for _, policy := range t.TargetPolicies {
+		names = append(names, policy.Name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
 type ResultInfo struct {
 	Page       int `json:"page"`
 	PerPage    int `json:"per_page"`
@@ -83,28 +122,69 @@ type ApiResponse struct {
 	ResultInfo ResultInfo    `json:"result_info"`
 }
 
-// createRequest creates a new http request with the given url, page and perPage
-func createRequest(ctx context.Context, url string, page int, perPage int) (*http.Request, error) {
+// createRequest creates a new http request with the given url, page and perPage, optionally filtered to devices
+func createRequest(ctx context.Context, url string, page int, perPage int, deviceIDs []string) (*http.Request, error) {
 	log.Printf("Creating request for %s", url)
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Authorization", "Bearer "+config.ApiKey)
+	config.SetAuthHeaders(req)
 	req.Header.Set("Content-Type", "application/json")
 
 	q := req.URL.Query()
 	q.Add("per_page", fmt.Sprintf("%d", perPage))
 	q.Add("page", fmt.Sprintf("%d", page))
 	q.Add("timeEnd", time.Now().Format(time.RFC3339))
-	q.Add("timeStart", time.Now().Add(-time.Hour).Format(time.RFC3339))
+	q.Add("timeStart", time.Now().Add(-config.DexTestsWindow).Format(time.RFC3339))
+	for _, deviceID := range deviceIDs {
+		q.Add("deviceId", deviceID)
+	}
 	req.URL.RawQuery = q.Encode()
 
 	return req, nil
 }
 
-// CollectDexTests fetches all the tests from the dex API
-func CollectDexTests(ctx context.Context, accountID string) (map[string]DexTests, error) {
+// fetchResult requests a DEX endpoint and decodes the result field of the response into result
+func fetchResult(ctx context.Context, url string, query map[string]string, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	config.SetAuthHeaders(req)
+	req.Header.Set("Content-Type", "application/json")
+	q := req.URL.Query()
+	for key, value := range query {
+		q.Add(key, value)
+	}
+	req.URL.RawQuery = q.Encode()
+
+	appmetrics.IncApiCallCounter()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	response := struct {
+		Result   json.RawMessage `json:"result"`
+		Success  bool            `json:"success"`
+		Messages []interface{}   `json:"messages"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	if !response.Success {
+		return fmt.Errorf("request failed: %v", response.Messages)
+	}
+	return json.Unmarshal(response.Result, result)
+}
+
+// FetchDexTests fetches all the tests from the dex API, with results limited to deviceIDs if given
+func FetchDexTests(ctx context.Context, accountID string, deviceIDs ...string) (map[string]DexTests, error) {
 	log.Printf("Fetching dex tests for account %s", accountID)
 	startTime := time.Now()
 	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/dex/tests", accountID)
@@ -115,7 +195,7 @@ func CollectDexTests(ctx context.Context, accountID string) (map[string]DexTests
 
 	for {
 		log.Printf("Fetching page %d of dex tests", page)
-		req, err := createRequest(ctx, url, page, perPage)
+		req, err := createRequest(ctx, url, page, perPage, deviceIDs)
 		if err != nil {
 			log.Printf("Error creating request: %v", err)
 			return nil, err
@@ -177,28 +257,61 @@ func CollectDexTests(ctx context.Context, accountID string) (map[string]DexTests
 		log.Printf("Fetched %d dex tests in %v", len(tests), time.Since(startTime))
 	}
 
+	return tests, nil
+}
+
+// CollectDexTests fetches all the tests from the dex API and updates the test metrics
+func CollectDexTests(ctx context.Context, accountID string) (map[string]DexTests, error) {
+	tests, err := FetchDexTests(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	values, states := testMetrics(tests)
+	historyGauges.Update(values)
+	stateGauges.Update(states)
+
+	return tests, nil
+}
+
+// testMetrics returns the info and history series of the tests, and the test counts per kind and state
+func testMetrics(tests map[string]DexTests) (map[string]float64, map[string]float64) {
+	values := make(map[string]float64)
+	states := make(map[string]float64)
 	for _, test := range tests {
+		state := "disabled"
+		if test.Enabled {
+			state = "enabled"
+		}
+		states[fmt.Sprintf(`zerotrust_dex_tests{kind="%s", state="%s"}`, test.Kind, state)]++
+		values[fmt.Sprintf(`zerotrust_dex_test_info{test_id="%s", test_name="%s", kind="%s", interval="%s", enabled="%t", targeted="%t", target_policies="%s"}`,
+			test.TestID, exposition.EscapeLabelValue(test.TestName), test.Kind, test.Interval, test.Enabled, test.Targeted, exposition.EscapeLabelValue(test.targetPolicyNames()))] = 1
+
+		var history []History
 		switch test.Kind {
 		case "traceroute":
 			if test.TracerouteResults != nil {
-				for _, h := range test.TracerouteResults.RoundTripTime.History {
-					if h.TimePeriod.Value == 1 && h.TimePeriod.Units == "hours" {
-						metrics.GetOrCreateGauge(fmt.Sprintf(`zerotrust_dex_test_1h_avg_ms{test_id="%s", test_name="%s", description="%s", host="%s", kind="%s"}`, test.TestID, test.TestName, test.Description, test.Host, test.Kind), func() float64 { return float64(h.AvgMs) })
-					}
-				}
+				history = test.TracerouteResults.RoundTripTime.History
 			}
 		case "http":
 			if test.HTTPResults != nil {
-				for _, h := range test.HTTPResults.ResourceFetchTime.History {
-					if h.TimePeriod.Value == 1 && h.TimePeriod.Units == "hours" {
-						metrics.GetOrCreateGauge(fmt.Sprintf(`zerotrust_dex_test_1h_avg_ms{test_id="%s", test_name="%s", description="%s", host="%s", kind="%s"}`, test.TestID, test.TestName, test.Description, test.Host, test.Kind), func() float64 { return float64(h.AvgMs) })
-					}
-				}
+				history = test.HTTPResults.ResourceFetchTime.History
 			}
 		}
-	}
 
-	return tests, nil
+		labels := fmt.Sprintf(`test_id="%s", test_name="%s", description="%s", host="%s", kind="%s"`,
+			test.TestID, exposition.EscapeLabelValue(test.TestName), exposition.EscapeLabelValue(test.Description), exposition.EscapeLabelValue(test.Host), test.Kind)
+		for _, h := range history {
+			window := h.TimePeriod.window()
+			values[fmt.Sprintf(`zerotrust_dex_test_avg_ms{%s, window="%s"}`, labels, window)] = float64(h.AvgMs)
+			values[fmt.Sprintf(`zerotrust_dex_test_delta_pct{%s, window="%s"}`, labels, window)] = h.DeltaPct
+			// Kept for existing dashboards, superseded by zerotrust_dex_test_avg_ms{window="1h"}
+			if window == "1h" {
+				values[fmt.Sprintf(`zerotrust_dex_test_1h_avg_ms{%s}`, labels)] = float64(h.AvgMs)
+			}
+		}
+	}
+	return values, states
 }
 
 // CollectDexMetrics collects metrics for dex
@@ -220,6 +333,19 @@ func CollectDexMetrics(ctx context.Context, accountID string) {
 	for testID := range tests {
 		testIDs = append(testIDs, testID)
 	}
-	// Collect traceroute metrics
-	CollectTracerouteMetrics(ctx, accountID, testIDs)
+	// Collect traceroute metrics and the device coverage of all tests
+	cov := newCoverage()
+	CollectTracerouteMetrics(ctx, accountID, testIDs, cov)
+	CollectHTTPTestMetrics(ctx, accountID, tests, cov)
+	cov.update(ctx, accountID)
+
+	// Collect the results of the allowlisted devices
+	if len(config.DexDevices) > 0 {
+		CollectDeviceTestMetrics(ctx, accountID)
+	}
+
+	// Collect per-hop network paths of the selected tests
+	if len(config.DexNetworkPathTests) > 0 {
+		CollectNetworkPathMetrics(ctx, accountID)
+	}
 }
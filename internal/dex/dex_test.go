@@ -0,0 +1,45 @@
+package dex
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+func TestTestMetricsEscapesLabels(t *testing.T) {
+	var test DexTests
+	if err := json.Unmarshal([]byte(`{
+		"id": "test-1",
+		"name": "Portal \"prod\"",
+		"kind": "http",
+		"description": "Checks C:\\portal and \"login\"\nsecond line",
+		"host": "https://portal.example.com/?q=\"x\"",
+		"httpResults": {"resourceFetchTime": {"history": [{"avgMs": 120, "deltaPct": 5.5, "timePeriod": {"value": 1, "units": "hours"}}]}}
+	}`), &test); err != nil {
+		t.Fatal(err)
+	}
+
+	values, _ := testMetrics(map[string]DexTests{test.TestID: test})
+
+	// An unescaped quote or backslash makes the metrics package panic on the series name
+	set := metrics.NewSet()
+	for name, value := range values {
+		set.GetOrCreateGauge(name, nil).Set(value)
+	}
+	var buf bytes.Buffer
+	set.WritePrometheus(&buf)
+
+	labels := `test_id="test-1", test_name="Portal \"prod\"", description="Checks C:\\portal and \"login\"\nsecond line", host="https://portal.example.com/?q=\"x\"", kind="http"`
+	for _, want := range []string{
+		`zerotrust_dex_test_avg_ms{` + labels + `, window="1h"} 120`,
+		`zerotrust_dex_test_delta_pct{` + labels + `, window="1h"} 5.5`,
+		`zerotrust_dex_test_1h_avg_ms{` + labels + `} 120`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("missing series %s in:\n%s", want, buf.String())
+		}
+	}
+}
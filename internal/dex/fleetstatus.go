@@ -0,0 +1,155 @@
+package dex
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/vinistoisr/zerotrust-exporter/internal/appmetrics"
+	"github.com/vinistoisr/zerotrust-exporter/internal/config"
+	"github.com/vinistoisr/zerotrust-exporter/internal/gauges"
+)
+
+// DimensionCount is the number of unique devices for a single value of a dimension
+type DimensionCount struct {
+	Value              string `json:"value"`
+	UniqueDevicesTotal int    `json:"uniqueDevicesTotal"`
+}
+
+// FleetDeviceStats breaks the devices down by each dimension
+type FleetDeviceStats struct {
+	ByColo             []DimensionCount `json:"byColo"`
+	ByMode             []DimensionCount `json:"byMode"`
+	ByPlatform         []DimensionCount `json:"byPlatform"`
+	ByStatus           []DimensionCount `json:"byStatus"`
+	UniqueDevicesTotal int              `json:"uniqueDevicesTotal"`
+}
+
+// FleetStatusLive is the result of the fleet-status live endpoint
+type FleetStatusLive struct {
+	DeviceStats FleetDeviceStats `json:"deviceStats"`
+}
+
+// FleetStatusSnapshot is a single time bucket of the fleet-status over-time endpoint
+type FleetStatusSnapshot struct {
+	Timestamp string           `json:"timestamp"`
+	ByStatus  []DimensionCount `json:"byStatus"`
+	// UniqueDevicesTotal is the number of devices seen in the bucket
+	UniqueDevicesTotal int `json:"uniqueDevicesTotal"`
+}
+
+// FleetStatusOverTime is the result of the fleet-status over-time endpoint
+type FleetStatusOverTime struct {
+	DeviceStats []FleetStatusSnapshot `json:"deviceStats"`
+}
+
+var (
+	// fleetGauges holds the live device counts per dimension value
+	fleetGauges gauges.Group
+	// overTimeGauges holds the latest and peak device counts per status over the window
+	overTimeGauges gauges.Group
+)
+
+// fleetDimensions lists the live device count families and the breakdown each one reports.
+// Every dimension counts all devices, so each has its own family to keep them summable.
+var fleetDimensions = []struct {
+	family string
+	label  string
+	value  func(FleetDeviceStats) []DimensionCount
+}{
+	{"zerotrust_dex_fleet_devices_by_status", "status", func(s FleetDeviceStats) []DimensionCount { return s.ByStatus }},
+	{"zerotrust_dex_fleet_devices_by_colo", "colo", func(s FleetDeviceStats) []DimensionCount { return s.ByColo }},
+	{"zerotrust_dex_fleet_devices_by_platform", "platform", func(s FleetDeviceStats) []DimensionCount { return s.ByPlatform }},
+	{"zerotrust_dex_fleet_devices_by_mode", "mode", func(s FleetDeviceStats) []DimensionCount { return s.ByMode }},
+}
+
+// FetchFleetStatusLive fetches the device counts of the devices seen within the lookback window
+func FetchFleetStatusLive(ctx context.Context, accountID string) (FleetStatusLive, error) {
+	var live FleetStatusLive
+	err := fetchLive(ctx, accountID, config.DevicesLookback, &live)
+	return live, err
+}
+
+// fetchLive fetches the device counts of the devices seen within since
+func fetchLive(ctx context.Context, accountID string, since time.Duration, live *FleetStatusLive) error {
+	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/dex/fleet-status/live", accountID)
+	minutes := int(since.Minutes())
+	if minutes < 1 {
+		minutes = 1
+	}
+	return fetchResult(ctx, url, map[string]string{"since_minutes": fmt.Sprintf("%d", minutes)}, live)
+}
+
+// FetchFleetStatusOverTime fetches the device counts over the fleet status window
+func FetchFleetStatusOverTime(ctx context.Context, accountID string) (FleetStatusOverTime, error) {
+	var overTime FleetStatusOverTime
+	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/dex/fleet-status/over-time", accountID)
+	timeEnd := time.Now()
+	err := fetchResult(ctx, url, map[string]string{
+		"time_end":   timeEnd.Format(time.RFC3339),
+		"time_start": timeEnd.Add(-config.FleetStatusWindow).Format(time.RFC3339),
+	}, &overTime)
+	return overTime, err
+}
+
+// CollectFleetStatusMetrics collects the aggregate fleet status device counts
+func CollectFleetStatusMetrics(ctx context.Context, accountID string) {
+	startTime := time.Now()
+	live, err := FetchFleetStatusLive(ctx, accountID)
+	if err != nil {
+		log.Printf("Error fetching live fleet status: %v", err)
+		appmetrics.IncApiErrorsCounter()
+		appmetrics.SetUpMetric(0)
+	} else {
+		values := make(map[string]float64)
+		for _, dimension := range fleetDimensions {
+			for _, count := range dimension.value(live.DeviceStats) {
+				values[fmt.Sprintf(`%s{%s="%s"}`, dimension.family, dimension.label, count.Value)] = float64(count.UniqueDevicesTotal)
+			}
+		}
+		values["zerotrust_dex_fleet_devices_unique"] = float64(live.DeviceStats.UniqueDevicesTotal)
+		fleetGauges.Update(values)
+	}
+
+	overTime, err := FetchFleetStatusOverTime(ctx, accountID)
+	if err != nil {
+		log.Printf("Error fetching fleet status over time: %v", err)
+		appmetrics.IncApiErrorsCounter()
+		appmetrics.SetUpMetric(0)
+		return
+	}
+	updateOverTime(overTime.DeviceStats)
+
+	if config.Debug {
+		log.Printf("Fetched fleet status with %d time buckets in %v", len(overTime.DeviceStats), time.Since(startTime))
+	}
+}
+
+// updateOverTime exports the most recent bucket and the peak per status over the window
+func updateOverTime(snapshots []FleetStatusSnapshot) {
+	values := make(map[string]float64)
+	var latest FleetStatusSnapshot
+	var latestTime time.Time
+	for _, snapshot := range snapshots {
+		timestamp, err := time.Parse(time.RFC3339Nano, snapshot.Timestamp)
+		if err != nil {
+			continue
+		}
+		if timestamp.After(latestTime) {
+			latest, latestTime = snapshot, timestamp
+		}
+		for _, count := range snapshot.ByStatus {
+			name := fmt.Sprintf(`zerotrust_dex_fleet_devices_peak{status="%s"}`, count.Value)
+			values[name] = max(values[name], float64(count.UniqueDevicesTotal))
+		}
+		values["zerotrust_dex_fleet_devices_unique_peak"] = max(values["zerotrust_dex_fleet_devices_unique_peak"], float64(snapshot.UniqueDevicesTotal))
+	}
+	if !latestTime.IsZero() {
+		for _, count := range latest.ByStatus {
+			values[fmt.Sprintf(`zerotrust_dex_fleet_devices_latest{status="%s"}`, count.Value)] = float64(count.UniqueDevicesTotal)
+		}
+		values["zerotrust_dex_fleet_devices_latest_timestamp_seconds"] = float64(latestTime.Unix())
+	}
+	overTimeGauges.Update(values)
+}
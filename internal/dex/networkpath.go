@@ -0,0 +1,145 @@
+package dex
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/vinistoisr/zerotrust-exporter/internal/appmetrics"
+	"github.com/vinistoisr/zerotrust-exporter/internal/config"
+	"github.com/vinistoisr/zerotrust-exporter/internal/exposition"
+	"github.com/vinistoisr/zerotrust-exporter/internal/gauges"
+)
+
+// NetworkPathSlot is a single traceroute run in a test's network path
+type NetworkPathSlot struct {
+	ID        string `json:"id"`
+	Timestamp string `json:"timestamp"`
+}
+
+// TestNetworkPath is the result of the traceroute test network-path endpoint for a device
+type TestNetworkPath struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Host        string `json:"host"`
+	NetworkPath struct {
+		Slots []NetworkPathSlot `json:"slots"`
+	} `json:"networkPath"`
+}
+
+// NetworkPathHop is a single hop of a traceroute run
+type NetworkPathHop struct {
+	TTL           int     `json:"ttl"`
+	ASN           int     `json:"asn"`
+	ASO           string  `json:"aso"`
+	IPAddress     string  `json:"ipAddress"`
+	Name          string  `json:"name"`
+	PacketLossPct float64 `json:"packetLossPct"`
+	RTTMs         float64 `json:"rttMs"`
+}
+
+// ResultNetworkPath is the result of the traceroute test result network-path endpoint
+type ResultNetworkPath struct {
+	Hops []NetworkPathHop `json:"hops"`
+}
+
+var (
+	// hopGauges holds the per-hop series, removed when a hop disappears from the path
+	hopGauges = gauges.Group{Remove: true}
+
+	pathMu sync.Mutex
+	// pathHashes is the last seen path of each test and device
+	pathHashes = make(map[string]string)
+)
+
+// FetchTestNetworkPath fetches the traceroute runs of a test on a device within the traceroute window
+func FetchTestNetworkPath(ctx context.Context, accountID, testID, deviceID string) (TestNetworkPath, error) {
+	var path TestNetworkPath
+	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/dex/traceroute-tests/%s/network-path", accountID, testID)
+	timeEnd := time.Now()
+	err := fetchResult(ctx, url, map[string]string{
+		"deviceId": deviceID,
+		"from":     timeEnd.Add(-config.DexTracerouteWindow).Format(time.RFC3339),
+		"to":       timeEnd.Format(time.RFC3339),
+		"interval": "minute",
+	}, &path)
+	return path, err
+}
+
+// FetchResultNetworkPath fetches the hops of a single traceroute run
+func FetchResultNetworkPath(ctx context.Context, accountID, resultID string) (ResultNetworkPath, error) {
+	var path ResultNetworkPath
+	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/dex/traceroute-test-results/%s/network-path", accountID, resultID)
+	err := fetchResult(ctx, url, nil, &path)
+	return path, err
+}
+
+// CollectNetworkPathMetrics exports the hops of the latest traceroute run of the selected tests and devices
+func CollectNetworkPathMetrics(ctx context.Context, accountID string) {
+	values := make(map[string]float64)
+	for _, testID := range config.DexNetworkPathTests {
+		for _, deviceID := range config.DexNetworkPathDevices {
+			if err := collectNetworkPath(ctx, accountID, testID, deviceID, values); err != nil {
+				log.Printf("Error fetching network path of test %s on device %s: %v", testID, deviceID, err)
+				appmetrics.IncApiErrorsCounter()
+				appmetrics.SetUpMetric(0)
+			}
+		}
+	}
+	hopGauges.Update(values)
+}
+
+// collectNetworkPath adds the hop series of a test and device to values and tracks path changes
+func collectNetworkPath(ctx context.Context, accountID, testID, deviceID string, values map[string]float64) error {
+	testPath, err := FetchTestNetworkPath(ctx, accountID, testID, deviceID)
+	if err != nil {
+		return err
+	}
+	var latest NetworkPathSlot
+	for _, slot := range testPath.NetworkPath.Slots {
+		if slot.ID != "" && slot.Timestamp > latest.Timestamp {
+			latest = slot
+		}
+	}
+	if latest.ID == "" {
+		if config.Debug {
+			log.Printf("No traceroute runs of test %s on device %s", testID, deviceID)
+		}
+		return nil
+	}
+
+	resultPath, err := FetchResultNetworkPath(ctx, accountID, latest.ID)
+	if err != nil {
+		return err
+	}
+
+	hops := make([]string, 0, len(resultPath.Hops))
+	for _, hop := range resultPath.Hops {
+		labels := fmt.Sprintf(`test_id="%s", test_name="%s", device_id="%s", hop_index="%d", asn="%d", as_name="%s"`,
+			testID, exposition.EscapeLabelValue(testPath.Name), deviceID, hop.TTL, hop.ASN, exposition.EscapeLabelValue(hop.ASO))
+		values[fmt.Sprintf(`zerotrust_dex_network_path_hop_rtt_ms{%s}`, labels)] = hop.RTTMs
+		values[fmt.Sprintf(`zerotrust_dex_network_path_hop_packet_loss_pct{%s}`, labels)] = hop.PacketLossPct
+		hops = append(hops, fmt.Sprintf("%d/%d/%s", hop.TTL, hop.ASN, hop.IPAddress))
+	}
+	sum := sha256.Sum256([]byte(strings.Join(hops, ",")))
+	hash := hex.EncodeToString(sum[:])[:12]
+	values[fmt.Sprintf(`zerotrust_dex_network_path_info{test_id="%s", device_id="%s", path_hash="%s", hops="%d"}`, testID, deviceID, hash, len(hops))] = 1
+
+	key := testID + "/" + deviceID
+	changes := metrics.GetOrCreateCounter(fmt.Sprintf(`zerotrust_dex_network_path_changes_total{test_id="%s", device_id="%s"}`, testID, deviceID))
+	pathMu.Lock()
+	defer pathMu.Unlock()
+	if previous, ok := pathHashes[key]; ok && previous != hash {
+		log.Printf("Network path of test %s on device %s changed", testID, deviceID)
+		changes.Inc()
+		metrics.GetOrCreateGauge(fmt.Sprintf(`zerotrust_dex_network_path_last_change_timestamp_seconds{test_id="%s", device_id="%s"}`, testID, deviceID), nil).Set(float64(time.Now().Unix()))
+	}
+	pathHashes[key] = hash
+	return nil
+}
@@ -71,13 +71,13 @@ type TracerouteTestResult struct {
 	Interval        string          `json:"interval"`
 	TracerouteStats TracerouteStats `json:"tracerouteStats"`
 	Targeted        bool            `json:"targeted"`
-	TargetPolicies  []interface{}   `json:"target_policies"`
+	TargetPolicies  []TargetPolicy  `json:"target_policies"`
 }
 
 const maxRetries = 3
 
 // fetchTestDetails fetches and processes the details of a single traceroute test
-func fetchTestDetails(ctx context.Context, accountID string, testID string, wg *sync.WaitGroup) {
+func fetchTestDetails(ctx context.Context, accountID string, testID string, cov *coverage, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/dex/traceroute-tests/%s", accountID, testID)
@@ -88,12 +88,12 @@ func fetchTestDetails(ctx context.Context, accountID string, testID string, wg *
 			log.Printf("Error creating request for test %s: %v", testID, err)
 			return
 		}
-		req.Header.Set("Authorization", "Bearer "+config.ApiKey)
+		config.SetAuthHeaders(req)
 		req.Header.Set("Content-Type", "application/json")
 
 		q := req.URL.Query()
 		q.Add("timeEnd", time.Now().Format(time.RFC3339))
-		q.Add("timeStart", time.Now().Add(-time.Hour).Format(time.RFC3339))
+		q.Add("timeStart", time.Now().Add(-config.DexTracerouteWindow).Format(time.RFC3339))
 		q.Add("interval", "minute")
 		req.URL.RawQuery = q.Encode()
 
@@ -175,18 +175,19 @@ func fetchTestDetails(ctx context.Context, accountID string, testID string, wg *
 		metrics.GetOrCreateGauge(fmt.Sprintf(`zerotrust_traceroute_hops{test_id="%s", test_name="%s", host="%s"}`, testID, response.Result.Name, response.Result.Host), func() float64 { return float64(latestHops.Value) })
 		metrics.GetOrCreateGauge(fmt.Sprintf(`zerotrust_traceroute_packet_loss{test_id="%s", test_name="%s", host="%s"}`, testID, response.Result.Name, response.Result.Host), func() float64 { return float64(latestPacketLoss.Value) })
 		metrics.GetOrCreateGauge(fmt.Sprintf(`zerotrust_traceroute_availability{test_id="%s", test_name="%s", host="%s"}`, testID, response.Result.Name, response.Result.Host), func() float64 { return float64(latestAvailability.Value) })
+		cov.add(testID, response.Result.Name, response.Result.Kind, stats.UniqueDevicesTotal)
 
 		break
 	}
 }
 
 // CollectTracerouteMetrics fetches detailed metrics for each traceroute test
-func CollectTracerouteMetrics(ctx context.Context, accountID string, testIDs []string) {
+func CollectTracerouteMetrics(ctx context.Context, accountID string, testIDs []string, cov *coverage) {
 	var wg sync.WaitGroup
 	wg.Add(len(testIDs))
 
 	for _, testID := range testIDs {
-		go fetchTestDetails(ctx, accountID, testID, &wg)
+		go fetchTestDetails(ctx, accountID, testID, cov, &wg)
 	}
 
 	wg.Wait()
@@ -0,0 +1,272 @@
+package exposition
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/vinistoisr/zerotrust-exporter/internal/appmetrics"
+	"github.com/vinistoisr/zerotrust-exporter/internal/config"
+)
+
+// Label is a single name/value pair attached to a sample
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a single series parsed from the Prometheus text exposition
+type Sample struct {
+	Name   string
+	Labels []Label
+	Value  float64
+}
+
+// metadata holds the # HELP and # TYPE lines of each metric family
+type metadata map[string][]string
+
+func init() {
+	metrics.ExposeMetadata(true)
+}
+
+// Gather renders all registered metrics and parses them into samples with the configured label policies applied
+func Gather() ([]Sample, error) {
+	samples, _, err := gather(true)
+	return samples, err
+}
+
+// Write renders all registered metrics to w with the configured label policies applied
+func Write(w io.Writer, exposeProcessMetrics bool) error {
+	samples, meta, err := gather(exposeProcessMetrics)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	written := make(map[string]bool)
+	for _, sample := range samples {
+		// Families are written once, before their first remaining sample
+		family := sample.Name
+		if _, ok := meta[family]; !ok {
+			family = familyName(sample.Name)
+		}
+		if !written[family] {
+			written[family] = true
+			for _, line := range meta[family] {
+				buf.WriteString(line)
+				buf.WriteByte('\n')
+			}
+		}
+		writeSample(&buf, sample)
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// gather parses the registered metrics and applies the label policies
+func gather(exposeProcessMetrics bool) ([]Sample, metadata, error) {
+	var buf bytes.Buffer
+	metrics.WritePrometheus(&buf, exposeProcessMetrics)
+	samples, meta, err := parse(buf.Bytes())
+	if err != nil {
+		return nil, nil, err
+	}
+	samples = redact(samples)
+	samples = relabel(samples)
+	// Merge before limiting so only distinct series count, and again to sum the "other" series
+	samples = limit(merge(samples), meta)
+	return merge(samples), meta, nil
+}
+
+// merge sums samples that ended up with identical names and labels after labels were removed,
+// keeping the position of the first occurrence
+func merge(samples []Sample) []Sample {
+	index := make(map[string]int, len(samples))
+	merged := samples[:0]
+	for _, sample := range samples {
+		key := seriesKey(sample)
+		if i, ok := index[key]; ok {
+			merged[i].Value += sample.Value
+			continue
+		}
+		index[key] = len(merged)
+		merged = append(merged, sample)
+	}
+	return merged
+}
+
+// seriesKey returns a unique key for a sample's name and labels
+func seriesKey(sample Sample) string {
+	var sb strings.Builder
+	sb.WriteString(sample.Name)
+	for _, l := range sample.Labels {
+		sb.WriteByte(0)
+		sb.WriteString(l.Name)
+		sb.WriteByte(0)
+		sb.WriteString(l.Value)
+	}
+	return sb.String()
+}
+
+// writeSample writes a sample in Prometheus text exposition format
+func writeSample(buf *bytes.Buffer, sample Sample) {
+	buf.WriteString(sample.Name)
+	if len(sample.Labels) > 0 {
+		buf.WriteByte('{')
+		for i, l := range sample.Labels {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(l.Name)
+			buf.WriteString(`="`)
+			buf.WriteString(labelEscaper.Replace(l.Value))
+			buf.WriteByte('"')
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteByte(' ')
+	if float64(int64(sample.Value)) == sample.Value {
+		buf.WriteString(strconv.FormatInt(int64(sample.Value), 10))
+	} else {
+		buf.WriteString(strconv.FormatFloat(sample.Value, 'g', -1, 64))
+	}
+	buf.WriteByte('\n')
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// EscapeLabelValue escapes a free text label value for use between double quotes in a metric name
+func EscapeLabelValue(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+// Parse parses Prometheus text exposition data into samples, skipping comments
+func Parse(data []byte) ([]Sample, error) {
+	samples, _, err := parse(data)
+	return samples, err
+}
+
+// parse parses Prometheus text exposition data into samples and the metadata lines of each family.
+// Lines that cannot be parsed are skipped and counted, so one bad series does not fail the others.
+func parse(data []byte) ([]Sample, metadata, error) {
+	var samples []Sample
+	meta := make(metadata)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			if fields := strings.Fields(line); len(fields) >= 3 && (fields[1] == "HELP" || fields[1] == "TYPE") {
+				meta[fields[2]] = append(meta[fields[2]], line)
+			}
+			continue
+		}
+		sample, err := parseLine(line)
+		if err != nil {
+			appmetrics.InvalidExpositionLines.Inc()
+			if config.Debug {
+				log.Printf("Skipping invalid exposition line: %v", err)
+			}
+			continue
+		}
+		samples = append(samples, sample)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return samples, meta, nil
+}
+
+// parseLine parses a single `name{labels} value` line
+func parseLine(line string) (Sample, error) {
+	var sample Sample
+	n := strings.IndexAny(line, "{ ")
+	if n < 0 {
+		return sample, fmt.Errorf("missing value in line %q", line)
+	}
+	sample.Name = line[:n]
+	rest := line[n:]
+	if rest[0] == '{' {
+		labels, tail, err := parseLabels(rest[1:])
+		if err != nil {
+			return sample, fmt.Errorf("cannot parse labels in line %q: %w", line, err)
+		}
+		sample.Labels = labels
+		rest = tail
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return sample, fmt.Errorf("missing value in line %q", line)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return sample, fmt.Errorf("cannot parse value in line %q: %w", line, err)
+	}
+	sample.Value = value
+	return sample, nil
+}
+
+// parseLabels parses the label pairs following an opening brace and returns the remainder after the closing brace
+func parseLabels(s string) ([]Label, string, error) {
+	var labels []Label
+	for {
+		s = strings.TrimLeft(s, " ,")
+		if s == "" {
+			return nil, "", fmt.Errorf("missing closing brace")
+		}
+		if s[0] == '}' {
+			return labels, s[1:], nil
+		}
+		n := strings.IndexByte(s, '=')
+		if n < 0 {
+			return nil, "", fmt.Errorf("missing '=' after label name")
+		}
+		name := strings.TrimSpace(s[:n])
+		s = strings.TrimLeft(s[n+1:], " ")
+		if s == "" || s[0] != '"' {
+			return nil, "", fmt.Errorf("missing opening quote for label %q", name)
+		}
+		value, tail, err := parseQuoted(s[1:])
+		if err != nil {
+			return nil, "", fmt.Errorf("label %q: %w", name, err)
+		}
+		labels = append(labels, Label{Name: name, Value: value})
+		s = tail
+	}
+}
+
+// parseQuoted reads an escaped label value up to the closing quote. The escapes of the text
+// exposition format are decoded and any other backslash is kept verbatim.
+func parseQuoted(s string) (string, string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return sb.String(), s[i+1:], nil
+		case '\\':
+			if i+1 >= len(s) {
+				return "", "", fmt.Errorf("unterminated escape sequence")
+			}
+			switch s[i+1] {
+			case 'n':
+				sb.WriteByte('\n')
+				i++
+			case '\\', '"':
+				sb.WriteByte(s[i+1])
+				i++
+			default:
+				sb.WriteByte('\\')
+			}
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return "", "", fmt.Errorf("missing closing quote")
+}
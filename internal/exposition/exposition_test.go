@@ -0,0 +1,43 @@
+package exposition
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vinistoisr/zerotrust-exporter/internal/appmetrics"
+)
+
+func TestParseEscapes(t *testing.T) {
+	for _, tc := range []struct {
+		line string
+		want string
+	}{
+		{line: `zerotrust_device_info{device_name="CORP\\LAPTOP"} 1`, want: `CORP\LAPTOP`},
+		{line: `zerotrust_device_info{device_name="say \"hi\""} 1`, want: `say "hi"`},
+		{line: `zerotrust_device_info{device_name="two\nlines"} 1`, want: "two\nlines"},
+		{line: `zerotrust_device_info{device_name="C:\Users"} 1`, want: `C:\Users`},
+	} {
+		samples, err := Parse([]byte(tc.line))
+		if err != nil {
+			t.Fatalf("Parse(%s): %v", tc.line, err)
+		}
+		if len(samples) != 1 || samples[0].Labels[0].Value != tc.want {
+			t.Errorf("Parse(%s) = %+v, want device_name %q", tc.line, samples, tc.want)
+		}
+	}
+}
+
+func TestParseSkipsInvalidLines(t *testing.T) {
+	before := appmetrics.InvalidExpositionLines.Get()
+	samples, err := Parse([]byte("zerotrust_up 1\nzerotrust_broken{name=\"unterminated} 1\nzerotrust_devices 3\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Sample{{Name: "zerotrust_up", Value: 1}, {Name: "zerotrust_devices", Value: 3}}
+	if !reflect.DeepEqual(samples, want) {
+		t.Errorf("samples = %+v, want %+v", samples, want)
+	}
+	if got := appmetrics.InvalidExpositionLines.Get() - before; got != 1 {
+		t.Errorf("invalid lines increased by %d, want 1", got)
+	}
+}
@@ -0,0 +1,199 @@
+package exposition
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/vinistoisr/zerotrust-exporter/internal/appmetrics"
+	"github.com/vinistoisr/zerotrust-exporter/internal/config"
+)
+
+// Actions taken when a family exceeds its series limit
+const (
+	LimitDrop  = "drop"
+	LimitOther = "other"
+)
+
+// otherValue replaces label values of series aggregated into the overflow bucket
+const otherValue = "other"
+
+// Names of the exporter's own series limit metrics, which limit fills in with the values of the current gather
+const (
+	seriesMetric  = "zerotrust_exporter_series"
+	droppedMetric = "zerotrust_exporter_series_dropped_total"
+)
+
+var (
+	limitMu sync.Mutex
+	// admitted holds the series accepted per family, so existing series keep
+	// being exported while new ones are rejected once the limit is reached
+	admitted = make(map[string]map[string]bool)
+	// rejected holds the series rejected per family, so a series is counted as
+	// dropped once while it is present, however often the metrics are gathered
+	rejected = make(map[string]map[string]bool)
+	// droppedTotal mirrors the dropped series counters
+	droppedTotal = make(map[string]int)
+)
+
+// ParseSeriesLimits parses a comma separated list of family=limit pairs
+func ParseSeriesLimits(s string) (map[string]int, error) {
+	limits := make(map[string]int)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		family, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid series limit %q, expected family=limit", pair)
+		}
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("invalid series limit %q for family %q", value, family)
+		}
+		limits[strings.TrimSpace(family)] = limit
+	}
+	return limits, nil
+}
+
+// seriesLimit returns the configured limit for a family, 0 meaning unlimited
+func seriesLimit(family string) int {
+	if limit, ok := config.SeriesLimits[family]; ok {
+		return limit
+	}
+	return config.SeriesLimit
+}
+
+// limit enforces the per-family series limits on the zerotrust_* collector families.
+// Series admitted in earlier gathers are kept while they are still present, new
+// series beyond the limit are dropped or aggregated into an "other" series.
+// Only counters and histograms are aggregated, as summing gauges such as timestamps
+// or latencies is meaningless; gauges beyond the limit are always dropped.
+// Only the output is limited: the collectors still create every series in the
+// default metrics set, so the limit does not bound the exporter's own memory.
+func limit(samples []Sample, meta metadata) []Sample {
+	limitMu.Lock()
+	defer limitMu.Unlock()
+
+	types := metricTypes(meta)
+	present := make(map[string]map[string]bool)
+	result := samples[:0]
+	for _, sample := range samples {
+		family := familyName(sample.Name)
+		if sample.Name == seriesMetric || sample.Name == droppedMetric {
+			// Rendered before this gather updated them, added back below
+			continue
+		}
+		if !strings.HasPrefix(family, "zerotrust_") || strings.HasPrefix(family, "zerotrust_exporter_") {
+			result = append(result, sample)
+			continue
+		}
+
+		// Histogram buckets share the series key of their histogram
+		key := seriesKey(Sample{Labels: withoutStructural(sample.Labels)})
+		if present[family] == nil {
+			present[family] = make(map[string]bool)
+		}
+		present[family][key] = true
+		if admitted[family] == nil {
+			admitted[family] = make(map[string]bool)
+		}
+
+		maxSeries := seriesLimit(family)
+		if maxSeries == 0 || admitted[family][key] || len(admitted[family]) < maxSeries {
+			admitted[family][key] = true
+			delete(rejected[family], key)
+			result = append(result, sample)
+			continue
+		}
+
+		if rejected[family] == nil {
+			rejected[family] = make(map[string]bool)
+		}
+		if !rejected[family][key] {
+			rejected[family][key] = true
+			droppedTotal[family]++
+			appmetrics.AddSeriesDropped(family, 1)
+		}
+		if config.SeriesLimitAction == LimitOther && additive(types, sample.Name) {
+			sample.Labels = otherLabels(sample.Labels)
+			result = append(result, sample)
+		}
+	}
+
+	// Forget series that disappeared so their slots can be reused
+	for _, states := range []map[string]map[string]bool{admitted, rejected} {
+		for family, keys := range states {
+			for key := range keys {
+				if !present[family][key] {
+					delete(keys, key)
+				}
+			}
+		}
+	}
+
+	// Report the series per family before the limit was applied, with the values of this gather
+	families := make([]string, 0, len(present))
+	for family := range present {
+		families = append(families, family)
+	}
+	slices.Sort(families)
+	for _, family := range families {
+		appmetrics.SetSeriesCount(family, len(present[family]))
+		result = append(result, Sample{Name: seriesMetric, Labels: []Label{{Name: "family", Value: family}}, Value: float64(len(present[family]))})
+	}
+	for _, family := range families {
+		if n, ok := droppedTotal[family]; ok {
+			result = append(result, Sample{Name: droppedMetric, Labels: []Label{{Name: "family", Value: family}}, Value: float64(n)})
+		}
+	}
+	return result
+}
+
+// metricTypes returns the type of each metric family from its # TYPE line
+func metricTypes(meta metadata) map[string]string {
+	types := make(map[string]string, len(meta))
+	for family, lines := range meta {
+		for _, line := range lines {
+			if fields := strings.Fields(line); len(fields) >= 4 && fields[1] == "TYPE" {
+				types[family] = fields[3]
+			}
+		}
+	}
+	return types
+}
+
+// additive reports whether series of the metric can be summed into an "other" series
+func additive(types map[string]string, name string) bool {
+	typ, ok := types[name]
+	if !ok {
+		typ = types[familyName(name)]
+	}
+	return typ == "counter" || typ == "histogram"
+}
+
+// withoutStructural returns labels without histogram and summary bucket labels
+func withoutStructural(labels []Label) []Label {
+	result := make([]Label, 0, len(labels))
+	for _, l := range labels {
+		if !slices.Contains(structuralLabels, l.Name) {
+			result = append(result, l)
+		}
+	}
+	return result
+}
+
+// otherLabels replaces all label values except bucket labels with "other"
+func otherLabels(labels []Label) []Label {
+	result := make([]Label, len(labels))
+	for i, l := range labels {
+		if !slices.Contains(structuralLabels, l.Name) {
+			l.Value = otherValue
+		}
+		result[i] = l
+	}
+	return result
+}
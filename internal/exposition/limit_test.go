@@ -0,0 +1,55 @@
+package exposition
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/vinistoisr/zerotrust-exporter/internal/config"
+)
+
+func TestLimitOther(t *testing.T) {
+	config.SeriesLimit = 1
+	config.SeriesLimitAction = LimitOther
+	t.Cleanup(func() {
+		config.SeriesLimit = 0
+		config.SeriesLimitAction = LimitDrop
+	})
+
+	exposition := `# TYPE zerotrust_limit_last_seen_timestamp_seconds gauge
+zerotrust_limit_last_seen_timestamp_seconds{device_id="a"} 1700000001
+zerotrust_limit_last_seen_timestamp_seconds{device_id="b"} 1700000002
+zerotrust_limit_last_seen_timestamp_seconds{device_id="c"} 1700000003
+# TYPE zerotrust_limit_requests_total counter
+zerotrust_limit_requests_total{device_id="a"} 1
+zerotrust_limit_requests_total{device_id="b"} 2
+zerotrust_limit_requests_total{device_id="c"} 3
+`
+	// Every consumer gathers separately, the dropped series must still be counted once
+	var got string
+	for i := 0; i < 3; i++ {
+		samples, meta, err := parse([]byte(exposition))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		for _, sample := range merge(limit(merge(samples), meta)) {
+			if strings.HasPrefix(sample.Name, "zerotrust_limit_") || strings.HasPrefix(labelValue(sample.Labels, "family"), "zerotrust_limit_") {
+				writeSample(&buf, sample)
+			}
+		}
+		got = buf.String()
+	}
+
+	want := `zerotrust_limit_last_seen_timestamp_seconds{device_id="a"} 1700000001
+zerotrust_limit_requests_total{device_id="a"} 1
+zerotrust_limit_requests_total{device_id="other"} 5
+zerotrust_exporter_series{family="zerotrust_limit_last_seen_timestamp_seconds"} 3
+zerotrust_exporter_series{family="zerotrust_limit_requests_total"} 3
+zerotrust_exporter_series_dropped_total{family="zerotrust_limit_last_seen_timestamp_seconds"} 2
+zerotrust_exporter_series_dropped_total{family="zerotrust_limit_requests_total"} 2
+`
+	if got != want {
+		t.Errorf("limited series:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,92 @@
+package exposition
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/vinistoisr/zerotrust-exporter/internal/config"
+)
+
+// Redaction actions that can be applied to a label
+const (
+	RedactKeep = "keep"
+	RedactDrop = "drop"
+	RedactHash = "hash"
+	RedactMask = "mask"
+)
+
+// ParseRedactPolicy parses a comma separated list of label=action pairs
+func ParseRedactPolicy(s string) (map[string]string, error) {
+	policy := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		label, action, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid redaction rule %q, expected label=action", pair)
+		}
+		switch action {
+		case RedactKeep, RedactDrop, RedactHash, RedactMask:
+		default:
+			return nil, fmt.Errorf("invalid redaction action %q for label %q, expected keep, drop, hash or mask", action, label)
+		}
+		policy[strings.TrimSpace(label)] = action
+	}
+	return policy, nil
+}
+
+// redact applies the configured redaction policy to every sample's labels
+func redact(samples []Sample) []Sample {
+	if len(config.RedactLabels) == 0 {
+		return samples
+	}
+	for i := range samples {
+		labels := samples[i].Labels[:0:0]
+		for _, l := range samples[i].Labels {
+			switch config.RedactLabels[l.Name] {
+			case RedactDrop:
+				continue
+			case RedactHash:
+				l.Value = hashValue(l.Value)
+			case RedactMask:
+				l.Value = maskValue(l.Value)
+			}
+			labels = append(labels, l)
+		}
+		samples[i].Labels = labels
+	}
+	return samples
+}
+
+// hashValue returns a keyed HMAC-SHA256 of value, so the same value always maps to the same hash
+func hashValue(value string) string {
+	if value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, config.RedactKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// maskValue masks the local part of an email address, or everything after the first character otherwise
+func maskValue(value string) string {
+	if value == "" {
+		return ""
+	}
+	local, domain, isEmail := strings.Cut(value, "@")
+	if isEmail {
+		return firstRune(local) + "***@" + domain
+	}
+	return firstRune(value) + "***"
+}
+
+func firstRune(s string) string {
+	_, size := utf8.DecodeRuneInString(s)
+	return s[:size]
+}
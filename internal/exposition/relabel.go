@@ -0,0 +1,213 @@
+package exposition
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// FamilyConfig controls the output of a single metric family
+type FamilyConfig struct {
+	Enabled    *bool    `yaml:"enabled"`
+	DropLabels []string `yaml:"drop_labels"`
+	KeepLabels []string `yaml:"keep_labels"`
+}
+
+// RelabelRule is a subset of a Prometheus metric_relabel_configs entry
+type RelabelRule struct {
+	SourceLabels []string `yaml:"source_labels"`
+	Separator    *string  `yaml:"separator"`
+	Regex        string   `yaml:"regex"`
+	TargetLabel  string   `yaml:"target_label"`
+	Replacement  *string  `yaml:"replacement"`
+	Action       string   `yaml:"action"`
+
+	regex *regexp.Regexp
+}
+
+// RelabelConfig is the relabel configuration file format
+type RelabelConfig struct {
+	Families       map[string]FamilyConfig `yaml:"families"`
+	RelabelConfigs []RelabelRule           `yaml:"relabel_configs"`
+}
+
+// Labels that carry histogram and summary buckets and are never removed by keep_labels
+var structuralLabels = []string{"vmrange", "le", "quantile"}
+
+var relabelConfig *RelabelConfig
+
+// LoadRelabelConfig reads and validates the relabel configuration file at path
+func LoadRelabelConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var cfg RelabelConfig
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return fmt.Errorf("cannot parse %s: %w", path, err)
+	}
+
+	for i := range cfg.RelabelConfigs {
+		rule := &cfg.RelabelConfigs[i]
+		if rule.Action == "" {
+			rule.Action = "replace"
+		}
+		if rule.Regex == "" {
+			rule.Regex = "(.*)"
+		}
+		if rule.Separator == nil {
+			separator := ";"
+			rule.Separator = &separator
+		}
+		if rule.Replacement == nil {
+			replacement := "$1"
+			rule.Replacement = &replacement
+		}
+		rule.regex, err = regexp.Compile("^(?:" + rule.Regex + ")$")
+		if err != nil {
+			return fmt.Errorf("relabel rule %d: invalid regex: %w", i, err)
+		}
+		switch rule.Action {
+		case "replace":
+			if rule.TargetLabel == "" {
+				return fmt.Errorf("relabel rule %d: replace requires target_label", i)
+			}
+		case "keep", "drop":
+			if len(rule.SourceLabels) == 0 {
+				return fmt.Errorf("relabel rule %d: %s requires source_labels", i, rule.Action)
+			}
+		case "labeldrop", "labelkeep":
+		default:
+			return fmt.Errorf("relabel rule %d: unsupported action %q", i, rule.Action)
+		}
+	}
+
+	relabelConfig = &cfg
+	return nil
+}
+
+// relabel applies the family settings and relabel rules to samples, dropping filtered series
+func relabel(samples []Sample) []Sample {
+	if relabelConfig == nil {
+		return samples
+	}
+	result := samples[:0]
+	for _, sample := range samples {
+		if family, ok := relabelConfig.Families[familyName(sample.Name)]; ok {
+			if family.Enabled != nil && !*family.Enabled {
+				continue
+			}
+			sample.Labels = filterLabels(sample.Labels, family)
+		}
+		keep := true
+		for _, rule := range relabelConfig.RelabelConfigs {
+			if sample, keep = rule.apply(sample); !keep {
+				break
+			}
+		}
+		if keep {
+			result = append(result, sample)
+		}
+	}
+	return result
+}
+
+// filterLabels applies a family's drop_labels and keep_labels settings
+func filterLabels(labels []Label, family FamilyConfig) []Label {
+	filtered := make([]Label, 0, len(labels))
+	for _, l := range labels {
+		if slices.Contains(family.DropLabels, l.Name) {
+			continue
+		}
+		if len(family.KeepLabels) > 0 && !slices.Contains(family.KeepLabels, l.Name) && !slices.Contains(structuralLabels, l.Name) {
+			continue
+		}
+		filtered = append(filtered, l)
+	}
+	return filtered
+}
+
+// apply runs a single rule against a sample and reports whether the sample is kept
+func (rule RelabelRule) apply(sample Sample) (Sample, bool) {
+	values := make([]string, len(rule.SourceLabels))
+	for i, name := range rule.SourceLabels {
+		if name == "__name__" {
+			values[i] = sample.Name
+		} else {
+			values[i] = labelValue(sample.Labels, name)
+		}
+	}
+	value := strings.Join(values, *rule.Separator)
+
+	switch rule.Action {
+	case "keep":
+		return sample, rule.regex.MatchString(value)
+	case "drop":
+		return sample, !rule.regex.MatchString(value)
+	case "labeldrop", "labelkeep":
+		labels := make([]Label, 0, len(sample.Labels))
+		for _, l := range sample.Labels {
+			if rule.regex.MatchString(l.Name) == (rule.Action == "labelkeep") || slices.Contains(structuralLabels, l.Name) {
+				labels = append(labels, l)
+			}
+		}
+		sample.Labels = labels
+		return sample, true
+	default:
+		match := rule.regex.FindStringSubmatchIndex(value)
+		if match == nil {
+			return sample, true
+		}
+		target := string(rule.regex.ExpandString(nil, *rule.Replacement, value, match))
+		sample.Labels = setLabel(sample.Labels, rule.TargetLabel, target)
+		return sample, true
+	}
+}
+
+// familyName strips histogram series suffixes from a sample name
+func familyName(name string) string {
+	if relabelConfig != nil {
+		if _, ok := relabelConfig.Families[name]; ok {
+			return name
+		}
+	}
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		if family, ok := strings.CutSuffix(name, suffix); ok {
+			return family
+		}
+	}
+	return name
+}
+
+func labelValue(labels []Label, name string) string {
+	for _, l := range labels {
+		if l.Name == name {
+			return l.Value
+		}
+	}
+	return ""
+}
+
+// setLabel returns labels with name set to value, removing the label if value is empty
+func setLabel(labels []Label, name, value string) []Label {
+	result := make([]Label, 0, len(labels)+1)
+	found := false
+	for _, l := range labels {
+		if l.Name == name {
+			found = true
+			if value == "" {
+				continue
+			}
+			l.Value = value
+		}
+		result = append(result, l)
+	}
+	if !found && value != "" {
+		result = append(result, Label{Name: name, Value: value})
+	}
+	return result
+}
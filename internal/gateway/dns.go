@@ -0,0 +1,140 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vinistoisr/zerotrust-exporter/internal/appmetrics"
+	"github.com/vinistoisr/zerotrust-exporter/internal/config"
+	"github.com/vinistoisr/zerotrust-exporter/internal/exposition"
+	"github.com/vinistoisr/zerotrust-exporter/internal/gauges"
+)
+
+const dnsQuery = `query GatewayDNS($accountTag: string!, $start: Time!, $end: Time!, $limit: uint64!) {
+  viewer {
+    accounts(filter: {accountTag: $accountTag}) {
+      queries: gatewayResolverQueriesAdaptiveGroups(limit: $limit, filter: {datetime_geq: $start, datetime_lt: $end}) {
+        count
+        dimensions {
+          resolverDecision
+          policyId
+          locationId
+        }
+      }
+      categories: gatewayResolverByCategoryAdaptiveGroups(limit: $limit, filter: {datetime_geq: $start, datetime_lt: $end}) {
+        count
+        dimensions {
+          categoryId
+          resolverDecision
+        }
+      }
+    }
+  }
+}`
+
+// resolverDecisions names the resolverDecision codes of the Gateway DNS datasets, as listed in
+// https://developers.cloudflare.com/logs/reference/log-fields/account/gateway_dns/ (ResolverDecision)
+// and https://developers.cloudflare.com/analytics/graphql-api/ (gatewayResolverQueriesAdaptiveGroups)
+var resolverDecisions = map[int]string{
+	0:  "unknown",
+	1:  "allowedByQueryName",
+	2:  "blockedByQueryName",
+	3:  "blockedByCategory",
+	4:  "allowedOnNoLocation",
+	5:  "allowedOnNoPolicyMatch",
+	6:  "blockedAlwaysCategory",
+	7:  "overrideForSafeSearch",
+	8:  "overrideApplied",
+	9:  "blockedRule",
+	10: "allowedRule",
+}
+
+// DNSQueryGroup is the number of DNS queries with the same decision, policy and location
+type DNSQueryGroup struct {
+	Count      int `json:"count"`
+	Dimensions struct {
+		ResolverDecision int    `json:"resolverDecision"`
+		PolicyID         string `json:"policyId"`
+		LocationID       string `json:"locationId"`
+	} `json:"dimensions"`
+}
+
+// DNSCategoryGroup is the number of DNS queries with the same content category and decision
+type DNSCategoryGroup struct {
+	Count      int `json:"count"`
+	Dimensions struct {
+		CategoryID       int `json:"categoryId"`
+		ResolverDecision int `json:"resolverDecision"`
+	} `json:"dimensions"`
+}
+
+type dnsResult struct {
+	Viewer struct {
+		Accounts []struct {
+			Queries    []DNSQueryGroup    `json:"queries"`
+			Categories []DNSCategoryGroup `json:"categories"`
+		} `json:"accounts"`
+	} `json:"viewer"`
+}
+
+// dnsGauges holds the query counts of the current window, reset when a group disappears from it
+var dnsGauges gauges.Group
+
+// decision returns the name of a resolver decision and whether it allowed, blocked or overrode the query
+func decision(code int) (string, string) {
+	name, ok := resolverDecisions[code]
+	if !ok {
+		return strconv.Itoa(code), "unknown"
+	}
+	switch {
+	case strings.HasPrefix(name, "blocked"):
+		return name, "blocked"
+	case strings.HasPrefix(name, "allowed"):
+		return name, "allowed"
+	case strings.HasPrefix(name, "override"):
+		return name, "override"
+	}
+	return name, "unknown"
+}
+
+// CollectDNSMetrics collects the Gateway DNS query counts over the sliding window
+func CollectDNSMetrics(ctx context.Context) {
+	startTime := time.Now()
+	var result dnsResult
+	start, end := window(startTime)
+	if err := query(ctx, dnsQuery, start, end, &result); err != nil {
+		log.Printf("Error querying gateway dns analytics: %v", err)
+		appmetrics.IncApiErrorsCounter()
+		appmetrics.SetUpMetric(0)
+		return
+	}
+	policyNames := policies.get(ctx)
+	locationNames := locations.get(ctx)
+
+	values := make(map[string]float64)
+	for _, account := range result.Viewer.Accounts {
+		if len(account.Queries) >= queryLimit || len(account.Categories) >= queryLimit {
+			truncated("dns", start, end)
+		}
+		for _, group := range account.Queries {
+			name, action := decision(group.Dimensions.ResolverDecision)
+			values[fmt.Sprintf(`zerotrust_gateway_dns_queries{decision="%s", action="%s", policy_id="%s", policy_name="%s", location_id="%s", location_name="%s"}`,
+				name, action, group.Dimensions.PolicyID, exposition.EscapeLabelValue(policyNames[group.Dimensions.PolicyID]), group.Dimensions.LocationID, exposition.EscapeLabelValue(locationNames[group.Dimensions.LocationID]))] += float64(group.Count)
+		}
+		for _, group := range account.Categories {
+			_, action := decision(group.Dimensions.ResolverDecision)
+			values[fmt.Sprintf(`zerotrust_gateway_dns_queries_by_category{category_id="%d", action="%s"}`, group.Dimensions.CategoryID, action)] += float64(group.Count)
+		}
+	}
+	values["zerotrust_gateway_dns_window_start_timestamp_seconds"] = float64(start.Unix())
+	values["zerotrust_gateway_dns_window_end_timestamp_seconds"] = float64(end.Unix())
+	dnsGauges.Update(values)
+
+	if config.Debug {
+		log.Printf("Queried gateway dns analytics in %v", time.Since(startTime))
+	}
+}
@@ -0,0 +1,161 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/cloudflare/cloudflare-go"
+	"github.com/vinistoisr/zerotrust-exporter/internal/config"
+)
+
+// standIn serves the GraphQL endpoint with graphqlResponse and the Gateway policies, locations and
+// application types. It returns the number of requests served per path so far.
+func standIn(t *testing.T, graphqlResponse func(variables map[string]interface{}) string) func(path string) int {
+	t.Helper()
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Variables map[string]interface{} `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decoding graphql request: %v", err)
+		}
+		w.Write([]byte(graphqlResponse(req.Variables)))
+	})
+	mux.HandleFunc("/accounts/account/gateway/rules", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success": true, "result": [{"id": "policy-1", "name": "Block \"malware\""}]}`))
+	})
+	mux.HandleFunc("/accounts/account/gateway/locations", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success": true, "result": [{"id": "location-1", "name": "Office"}]}`))
+	})
+	mux.HandleFunc("/accounts/account/gateway/app_types", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success": true, "result": [
+			{"id": 10, "name": "Slack", "application_type_id": 4},
+			{"id": 11, "name": "Zoom", "application_type_id": 4},
+			{"id": 4, "name": "Collaboration & Online Meeting"}
+		]}`))
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls[r.URL.Path]++
+		mu.Unlock()
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := cloudflare.NewWithAPIToken("token", cloudflare.BaseURL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Client = client
+	config.ApiKey = "token"
+	config.AccountID = "account"
+	config.GraphQLEndpoint = server.URL + "/graphql"
+	config.GatewayWindow = 5 * time.Minute
+	config.GatewayDelay = 5 * time.Minute
+	policies.reset()
+	locations.reset()
+	appTypes.reset()
+	return func(path string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls[path]
+	}
+}
+
+// series returns the registered series starting with prefix
+func series(prefix string) []string {
+	var buf bytes.Buffer
+	metrics.WritePrometheus(&buf, false)
+	var lines []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, prefix) {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func TestCollectDNSMetrics(t *testing.T) {
+	var start, end string
+	standIn(t, func(variables map[string]interface{}) string {
+		start, _ = variables["start"].(string)
+		end, _ = variables["end"].(string)
+		return `{"data": {"viewer": {"accounts": [{
+			"queries": [
+				{"count": 10, "dimensions": {"resolverDecision": 9, "policyId": "policy-1", "locationId": "location-1"}},
+				{"count": 5, "dimensions": {"resolverDecision": 10, "policyId": "", "locationId": "location-1"}},
+				{"count": 1, "dimensions": {"resolverDecision": 42, "policyId": "", "locationId": ""}}
+			],
+			"categories": [
+				{"count": 3, "dimensions": {"categoryId": 68, "resolverDecision": 3}},
+				{"count": 2, "dimensions": {"categoryId": 68, "resolverDecision": 9}}
+			]
+		}]}}}`
+	})
+
+	CollectDNSMetrics(context.Background())
+
+	startTime, err := time.Parse(time.RFC3339, start)
+	if err != nil {
+		t.Fatalf("invalid start %q: %v", start, err)
+	}
+	endTime, err := time.Parse(time.RFC3339, end)
+	if err != nil {
+		t.Fatalf("invalid end %q: %v", end, err)
+	}
+	if endTime.Sub(startTime) != 5*time.Minute || endTime.Second() != 0 || time.Since(endTime) < config.GatewayDelay {
+		t.Errorf("unexpected window %s to %s", start, end)
+	}
+
+	got := strings.Join(series("zerotrust_gateway_dns_"), "\n")
+	for _, want := range []string{
+		`zerotrust_gateway_dns_queries{decision="blockedRule", action="blocked", policy_id="policy-1", policy_name="Block \"malware\"", location_id="location-1", location_name="Office"} 10`,
+		`zerotrust_gateway_dns_queries{decision="allowedRule", action="allowed", policy_id="", policy_name="", location_id="location-1", location_name="Office"} 5`,
+		`zerotrust_gateway_dns_queries{decision="42", action="unknown", policy_id="", policy_name="", location_id="", location_name=""} 1`,
+		`zerotrust_gateway_dns_queries_by_category{category_id="68", action="blocked"} 5`,
+		`zerotrust_gateway_dns_window_end_timestamp_seconds ` + strconv.FormatInt(endTime.Unix(), 10),
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing series %s in:\n%s", want, got)
+		}
+	}
+}
+
+func TestDecision(t *testing.T) {
+	// Codes as published for resolverDecision, not derived from the table under test
+	for _, tc := range []struct {
+		code   int
+		name   string
+		action string
+	}{
+		{0, "unknown", "unknown"},
+		{1, "allowedByQueryName", "allowed"},
+		{2, "blockedByQueryName", "blocked"},
+		{3, "blockedByCategory", "blocked"},
+		{4, "allowedOnNoLocation", "allowed"},
+		{5, "allowedOnNoPolicyMatch", "allowed"},
+		{6, "blockedAlwaysCategory", "blocked"},
+		{7, "overrideForSafeSearch", "override"},
+		{8, "overrideApplied", "override"},
+		{9, "blockedRule", "blocked"},
+		{10, "allowedRule", "allowed"},
+		{42, "42", "unknown"},
+	} {
+		name, action := decision(tc.code)
+		if name != tc.name || action != tc.action {
+			t.Errorf("decision(%d) = %q, %q, want %q, %q", tc.code, name, action, tc.name, tc.action)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/vinistoisr/zerotrust-exporter/internal/config"
+	"github.com/vinistoisr/zerotrust-exporter/internal/graphql"
+)
+
+// queryLimit is the maximum number of groups returned per dataset
+const queryLimit = 1000
+
+// settled returns the end of the last whole minute that is older than the ingestion delay,
+// so events still being ingested are not missed
+func settled(now time.Time) time.Time {
+	return now.Add(-config.GatewayDelay).Truncate(time.Minute)
+}
+
+// window returns the start and end of the sliding window queried from the analytics datasets,
+// aligned to whole minutes so overlapping scrapes within the same minute see the same window
+func window(now time.Time) (time.Time, time.Time) {
+	end := settled(now)
+	return end.Add(-config.GatewayWindow), end
+}
+
+// maxCatchUp bounds the range queried after the exporter was not collecting for a while
+const maxCatchUp = time.Hour
+
+// cursor tracks the end of the last range counted, so consecutive or overlapping
+// collections query adjacent ranges and every event is counted exactly once
+type cursor struct {
+	mu  sync.Mutex
+	end time.Time
+}
+
+// lock claims the cursor and returns the range not counted yet. The range is empty if
+// a collection already counted up to the current minute. unlock must be called with
+// end once the range is counted, or with start to retry the range later.
+func (c *cursor) lock(now time.Time) (time.Time, time.Time) {
+	c.mu.Lock()
+	end := settled(now)
+	start := c.end
+	if start.IsZero() {
+		start = end.Add(-config.GatewayWindow)
+	}
+	if end.Sub(start) > maxCatchUp {
+		log.Printf("Gateway analytics were not collected since %v, skipping to the last %v", start, maxCatchUp)
+		start = end.Add(-maxCatchUp)
+	}
+	return start, end
+}
+
+// unlock records end as counted and releases the cursor
+func (c *cursor) unlock(end time.Time) {
+	c.end = end
+	c.mu.Unlock()
+}
+
+// query runs an analytics query for the account over [start, end)
+func query(ctx context.Context, q string, start, end time.Time, result interface{}) error {
+	return graphql.NewClient(config.GraphQLEndpoint).Query(ctx, q, map[string]interface{}{
+		"accountTag": config.AccountID,
+		"start":      start.Format(time.RFC3339),
+		"end":        end.Format(time.RFC3339),
+		"limit":      queryLimit,
+	}, result)
+}
+
+// truncated logs and counts a query that returned queryLimit groups, so some groups were left out
+func truncated(dataset string, start, end time.Time) {
+	log.Printf("Gateway %s analytics from %v to %v reached the limit of %d groups, the counts are incomplete", dataset, start, end, queryLimit)
+	metrics.GetOrCreateCounter(fmt.Sprintf(`zerotrust_gateway_truncated_queries_total{dataset="%s"}`, dataset)).Inc()
+}
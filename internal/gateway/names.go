@@ -0,0 +1,131 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/vinistoisr/zerotrust-exporter/internal/appmetrics"
+	"github.com/vinistoisr/zerotrust-exporter/internal/config"
+	"github.com/vinistoisr/zerotrust-exporter/internal/exposition"
+	"github.com/vinistoisr/zerotrust-exporter/internal/gauges"
+)
+
+// namesTTL is how long fetched names are reused before they are fetched again
+const namesTTL = 5 * time.Minute
+
+// lookup caches names shared by the Gateway collectors, so enabling several of them
+// does not fetch the same names on every collection
+type lookup[T any] struct {
+	what  string
+	fetch func(ctx context.Context) (T, error)
+
+	mu      sync.Mutex
+	fetched time.Time
+	value   T
+}
+
+// get returns the cached value, fetching it again once it is older than namesTTL. If the
+// fetch fails, the previous value is returned, or the zero value if there is none, and
+// the next call tries again.
+func (l *lookup[T]) get(ctx context.Context) T {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.fetched.IsZero() && time.Since(l.fetched) < namesTTL {
+		return l.value
+	}
+	appmetrics.IncApiCallCounter()
+	value, err := l.fetch(ctx)
+	if err != nil {
+		log.Printf("Error fetching gateway %s, exporting IDs only: %v", l.what, err)
+		appmetrics.IncApiErrorsCounter()
+		return l.value
+	}
+	l.value = value
+	l.fetched = time.Now()
+	return value
+}
+
+// reset drops the cached value
+func (l *lookup[T]) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var zero T
+	l.value = zero
+	l.fetched = time.Time{}
+}
+
+var (
+	// policyInfoGauges holds the policy names, removed when a policy is deleted
+	policyInfoGauges = gauges.Group{Remove: true}
+	// appTypeInfoGauges holds the application type names, removed when a type is deleted
+	appTypeInfoGauges = gauges.Group{Remove: true}
+
+	policies  = &lookup[map[string]string]{what: "policies", fetch: fetchPolicyNames}
+	locations = &lookup[map[string]string]{what: "locations", fetch: fetchLocationNames}
+	// appTypes maps application IDs to their application type, the category shown in the dashboard
+	appTypes = &lookup[map[int]int]{what: "application types", fetch: fetchAppTypes}
+)
+
+// fetchPolicyNames fetches the Gateway policy names keyed by ID and exports them as info series
+func fetchPolicyNames(ctx context.Context) (map[string]string, error) {
+	rules, err := config.GetClient().TeamsRules(ctx, config.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(rules))
+	values := make(map[string]float64, len(rules))
+	for _, rule := range rules {
+		names[rule.ID] = rule.Name
+		values[fmt.Sprintf(`zerotrust_gateway_policy_info{policy_id="%s", policy_name="%s"}`, rule.ID, exposition.EscapeLabelValue(rule.Name))] = 1
+	}
+	policyInfoGauges.Update(values)
+	return names, nil
+}
+
+// fetchLocationNames fetches the Gateway location names keyed by ID
+func fetchLocationNames(ctx context.Context) (map[string]string, error) {
+	list, _, err := config.GetClient().TeamsLocations(ctx, config.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(list))
+	for _, location := range list {
+		names[location.ID] = location.Name
+	}
+	return names, nil
+}
+
+// appTypeEntry is an application or an application type; only applications have an application type ID
+type appTypeEntry struct {
+	ID                int    `json:"id"`
+	Name              string `json:"name"`
+	ApplicationTypeID *int   `json:"application_type_id"`
+}
+
+// fetchAppTypes fetches the application type of each Gateway application and exports the type names as info series
+func fetchAppTypes(ctx context.Context) (map[int]int, error) {
+	resp, err := config.GetClient().Raw(ctx, http.MethodGet, fmt.Sprintf("/accounts/%s/gateway/app_types", config.AccountID), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var entries []appTypeEntry
+	if err := json.Unmarshal(resp.Result, &entries); err != nil {
+		return nil, fmt.Errorf("error decoding application types: %w", err)
+	}
+	types := make(map[int]int)
+	values := make(map[string]float64)
+	for _, entry := range entries {
+		if entry.ApplicationTypeID != nil {
+			types[entry.ID] = *entry.ApplicationTypeID
+			continue
+		}
+		values[fmt.Sprintf(`zerotrust_gateway_app_type_info{app_type_id="%d", app_type_name="%s"}`, entry.ID, exposition.EscapeLabelValue(entry.Name))] = 1
+	}
+	appTypeInfoGauges.Update(values)
+	return types, nil
+}
@@ -0,0 +1,166 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/vinistoisr/zerotrust-exporter/internal/appmetrics"
+	"github.com/vinistoisr/zerotrust-exporter/internal/config"
+)
+
+const httpQuery = `query GatewayHTTP($accountTag: string!, $start: Time!, $end: Time!, $limit: uint64!) {
+  viewer {
+    accounts(filter: {accountTag: $accountTag}) {
+      groups: gatewayL7RequestsAdaptiveGroups(limit: $limit, filter: {datetime_geq: $start, datetime_lt: $end}) {
+        count
+        dimensions {
+          action
+          policyId
+          applicationIds: httpApplicationIds
+        }
+      }
+    }
+  }
+}`
+
+const networkQuery = `query GatewayNetwork($accountTag: string!, $start: Time!, $end: Time!, $limit: uint64!) {
+  viewer {
+    accounts(filter: {accountTag: $accountTag}) {
+      groups: gatewayL4SessionsAdaptiveGroups(limit: $limit, filter: {datetime_geq: $start, datetime_lt: $end}) {
+        count
+        dimensions {
+          action
+          policyId
+          applicationIds
+        }
+      }
+    }
+  }
+}`
+
+// PolicyGroup is the number of requests or sessions with the same action, policy and applications
+type PolicyGroup struct {
+	Count      int `json:"count"`
+	Dimensions struct {
+		Action         string `json:"action"`
+		PolicyID       string `json:"policyId"`
+		ApplicationIDs []int  `json:"applicationIds"`
+	} `json:"dimensions"`
+}
+
+type policyResult struct {
+	Viewer struct {
+		Accounts []struct {
+			Groups []PolicyGroup `json:"groups"`
+		} `json:"accounts"`
+	} `json:"viewer"`
+}
+
+// policyDataset is a Gateway policy dataset counted into the counter families prefixed with family
+type policyDataset struct {
+	name   string
+	query  string
+	family string
+	cursor cursor
+}
+
+var (
+	httpDataset    = &policyDataset{name: "http", query: httpQuery, family: "zerotrust_gateway_http_requests"}
+	networkDataset = &policyDataset{name: "network", query: networkQuery, family: "zerotrust_gateway_network_sessions"}
+)
+
+// fetch returns the groups of the dataset over [start, end). A range whose groups reach the
+// query limit is split in halves at a minute boundary, so busy ranges are counted completely.
+func (d *policyDataset) fetch(ctx context.Context, start, end time.Time) ([]PolicyGroup, error) {
+	var result policyResult
+	if err := query(ctx, d.query, start, end, &result); err != nil {
+		return nil, err
+	}
+	var groups []PolicyGroup
+	full := false
+	for _, account := range result.Viewer.Accounts {
+		groups = append(groups, account.Groups...)
+		full = full || len(account.Groups) >= queryLimit
+	}
+	if !full {
+		return groups, nil
+	}
+
+	middle := start.Add(end.Sub(start) / 2).Truncate(time.Minute)
+	if !middle.After(start) {
+		truncated(d.name, start, end)
+		return groups, nil
+	}
+	first, err := d.fetch(ctx, start, middle)
+	if err != nil {
+		return nil, err
+	}
+	second, err := d.fetch(ctx, middle, end)
+	if err != nil {
+		return nil, err
+	}
+	return append(first, second...), nil
+}
+
+// collect adds the events since the last collection to the dataset's counters. Each
+// minute is counted once, even if collections overlap or run more often than once a minute.
+func (d *policyDataset) collect(ctx context.Context) {
+	startTime := time.Now()
+	start, end := d.cursor.lock(startTime)
+	if !end.After(start) {
+		d.cursor.unlock(start)
+		return
+	}
+
+	groups, err := d.fetch(ctx, start, end)
+	if err != nil {
+		d.cursor.unlock(start)
+		log.Printf("Error querying gateway %s analytics: %v", d.name, err)
+		appmetrics.IncApiErrorsCounter()
+		appmetrics.SetUpMetric(0)
+		return
+	}
+	// The policy names are only exported as info series, refreshed here while they are cached
+	policies.get(ctx)
+	types := appTypes.get(ctx)
+
+	for _, group := range groups {
+		action := strings.ToLower(group.Dimensions.Action)
+		metrics.GetOrCreateCounter(fmt.Sprintf(`%s_total{action="%s", policy_id="%s"}`, d.family, action, group.Dimensions.PolicyID)).Add(group.Count)
+
+		// Count each event once per application type, however many applications of the type it matched
+		counted := make(map[string]bool)
+		for _, id := range group.Dimensions.ApplicationIDs {
+			appType := "unknown"
+			if typeID, ok := types[id]; ok {
+				appType = strconv.Itoa(typeID)
+			}
+			if counted[appType] {
+				continue
+			}
+			counted[appType] = true
+			metrics.GetOrCreateCounter(fmt.Sprintf(`%s_by_app_type_total{action="%s", app_type_id="%s"}`, d.family, action, appType)).Add(group.Count)
+		}
+	}
+	metrics.GetOrCreateGauge(fmt.Sprintf(`zerotrust_gateway_%s_counted_until_timestamp_seconds`, d.name), nil).Set(float64(end.Unix()))
+	d.cursor.unlock(end)
+
+	if config.Debug {
+		log.Printf("Counted gateway %s analytics from %v to %v in %v", d.name, start, end, time.Since(startTime))
+	}
+}
+
+// CollectHTTPMetrics counts the Gateway HTTP requests by action, policy and application type
+func CollectHTTPMetrics(ctx context.Context) {
+	httpDataset.collect(ctx)
+}
+
+// CollectNetworkMetrics counts the Gateway network sessions by action, policy and application type
+func CollectNetworkMetrics(ctx context.Context) {
+	networkDataset.collect(ctx)
+}
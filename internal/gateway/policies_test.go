@@ -0,0 +1,229 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/vinistoisr/zerotrust-exporter/internal/config"
+)
+
+func TestCursor(t *testing.T) {
+	config.GatewayWindow = 5 * time.Minute
+	config.GatewayDelay = 5 * time.Minute
+	now := time.Date(2026, 10, 18, 12, 30, 20, 0, time.UTC)
+	minute := func(m int) time.Time { return time.Date(2026, 10, 18, 12, m, 0, 0, time.UTC) }
+
+	t.Run("overlapping calls in the same minute", func(t *testing.T) {
+		var c cursor
+		start, end := c.lock(now)
+		if !start.Equal(minute(20)) || !end.Equal(minute(25)) {
+			t.Fatalf("first range = %v to %v, want 12:20 to 12:25", start, end)
+		}
+
+		// A second call waits for the first and then finds nothing left to count
+		locked := make(chan [2]time.Time)
+		go func() {
+			start, end := c.lock(now.Add(30 * time.Second))
+			locked <- [2]time.Time{start, end}
+		}()
+		select {
+		case <-locked:
+			t.Fatal("second call locked the cursor while the first held it")
+		case <-time.After(50 * time.Millisecond):
+		}
+		c.unlock(end)
+		second := <-locked
+		if second[1].After(second[0]) {
+			t.Errorf("second range = %v to %v, want empty", second[0], second[1])
+		}
+		c.unlock(second[0])
+
+		start, end = c.lock(now.Add(time.Minute))
+		if !start.Equal(minute(25)) || !end.Equal(minute(26)) {
+			t.Errorf("next range = %v to %v, want 12:25 to 12:26", start, end)
+		}
+		c.unlock(end)
+	})
+
+	t.Run("failure and retry", func(t *testing.T) {
+		var c cursor
+		start, _ := c.lock(now)
+		c.unlock(start)
+
+		retryStart, retryEnd := c.lock(now.Add(2 * time.Minute))
+		if !retryStart.Equal(minute(20)) || !retryEnd.Equal(minute(27)) {
+			t.Errorf("retried range = %v to %v, want 12:20 to 12:27", retryStart, retryEnd)
+		}
+		c.unlock(retryEnd)
+	})
+
+	t.Run("catch up clamp", func(t *testing.T) {
+		c := cursor{end: now.Add(-3 * time.Hour)}
+		start, end := c.lock(now)
+		if !end.Equal(minute(25)) || end.Sub(start) != maxCatchUp {
+			t.Errorf("range = %v to %v, want the last %v before 12:25", start, end, maxCatchUp)
+		}
+		c.unlock(end)
+	})
+}
+
+// minutesResponse answers a policy query with one group per policy counting the minutes in the queried range,
+// so a counter that covers each minute exactly once equals the number of minutes since the first query
+func minutesResponse(t *testing.T, variables map[string]interface{}, policies ...string) (string, time.Time, time.Time) {
+	t.Helper()
+	start, err := time.Parse(time.RFC3339, fmt.Sprint(variables["start"]))
+	if err != nil {
+		t.Fatalf("invalid start: %v", err)
+	}
+	end, err := time.Parse(time.RFC3339, fmt.Sprint(variables["end"]))
+	if err != nil {
+		t.Fatalf("invalid end: %v", err)
+	}
+	minutes := int(end.Sub(start) / time.Minute)
+	groups := make([]string, len(policies))
+	for i, policy := range policies {
+		groups[i] = fmt.Sprintf(`{"count": %d, "dimensions": {"action": "Block", "policyId": "%s", "applicationIds": [10, 11, 99]}}`, minutes, policy)
+	}
+	return `{"data": {"viewer": {"accounts": [{"groups": [` + strings.Join(groups, ",") + `]}]}}}`, start, end
+}
+
+func TestPolicyDatasetCollect(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		fail  bool
+		first time.Time
+		last  time.Time
+	)
+	calls := standIn(t, func(variables map[string]interface{}) string {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			return `{"data": null, "errors": [{"message": "unavailable"}]}`
+		}
+		response, start, end := minutesResponse(t, variables, "policy-1")
+		if first.IsZero() || start.Before(first) {
+			first = start
+		}
+		last = end
+		return response
+	})
+	d := &policyDataset{name: "collect", query: httpQuery, family: "zerotrust_gateway_collect_requests"}
+	counters := []string{
+		`zerotrust_gateway_collect_requests_total{action="block", policy_id="policy-1"}`,
+		`zerotrust_gateway_collect_requests_by_app_type_total{action="block", app_type_id="4"}`,
+		`zerotrust_gateway_collect_requests_by_app_type_total{action="block", app_type_id="unknown"}`,
+	}
+	before := make([]uint64, len(counters))
+	for i, counter := range counters {
+		before[i] = metrics.GetOrCreateCounter(counter).Get()
+	}
+
+	// A failed query is counted by the next collection
+	setFail := func(v bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		fail = v
+	}
+	setFail(true)
+	d.collect(context.Background())
+	setFail(false)
+
+	// Overlapping collections count every minute once
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.collect(context.Background())
+		}()
+	}
+	wg.Wait()
+	d.collect(context.Background())
+
+	want := uint64(last.Sub(first) / time.Minute)
+	if want < 5 {
+		t.Fatalf("counted %v to %v, want at least the %v window", first, last, config.GatewayWindow)
+	}
+	for i, counter := range counters {
+		if got := metrics.GetOrCreateCounter(counter).Get() - before[i]; got != want {
+			t.Errorf("%s increased by %d, want %d", counter, got, want)
+		}
+	}
+
+	got := strings.Join(series("zerotrust_gateway_"), "\n")
+	for _, want := range []string{
+		`zerotrust_gateway_policy_info{policy_id="policy-1", policy_name="Block \"malware\""} 1`,
+		`zerotrust_gateway_app_type_info{app_type_id="4", app_type_name="Collaboration & Online Meeting"} 1`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing series %s in:\n%s", want, got)
+		}
+	}
+
+	// The names are looked up once and shared with the other Gateway collectors
+	CollectDNSMetrics(context.Background())
+	if n := calls("/accounts/account/gateway/rules"); n != 1 {
+		t.Errorf("fetched the policies %d times, want 1", n)
+	}
+	if n := calls("/accounts/account/gateway/app_types"); n != 1 {
+		t.Errorf("fetched the application types %d times, want 1", n)
+	}
+}
+
+func TestPolicyDatasetFetchSplitsFullRanges(t *testing.T) {
+	full := make([]string, queryLimit)
+	for i := range full {
+		full[i] = fmt.Sprintf("policy-%d", i)
+	}
+	var (
+		mu     sync.Mutex
+		ranges []string
+	)
+	standIn(t, func(variables map[string]interface{}) string {
+		mu.Lock()
+		defer mu.Unlock()
+		response, start, end := minutesResponse(t, variables, "policy-1")
+		ranges = append(ranges, start.Format("15:04")+"-"+end.Format("15:04"))
+		if end.Sub(start) > 2*time.Minute {
+			response, _, _ = minutesResponse(t, variables, full...)
+		}
+		return response
+	})
+	d := &policyDataset{name: "split", query: httpQuery}
+
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	groups, err := d.fetch(context.Background(), start, start.Add(5*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0
+	for _, group := range groups {
+		total += group.Count
+	}
+	if total != 5 {
+		t.Errorf("counted %d minutes over %v, want 5", total, ranges)
+	}
+	if got, want := strings.Join(ranges, " "), "12:00-12:05 12:00-12:02 12:02-12:05 12:02-12:03 12:03-12:05"; got != want {
+		t.Errorf("queried %s, want %s", got, want)
+	}
+
+	// A single minute that is still full cannot be split and is counted as truncated
+	standIn(t, func(variables map[string]interface{}) string {
+		response, _, _ := minutesResponse(t, variables, full...)
+		return response
+	})
+	d = &policyDataset{name: "truncated", query: httpQuery}
+	truncatedQueries := metrics.GetOrCreateCounter(`zerotrust_gateway_truncated_queries_total{dataset="truncated"}`)
+	before := truncatedQueries.Get()
+	if _, err := d.fetch(context.Background(), start, start.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if got := truncatedQueries.Get() - before; got != 1 {
+		t.Errorf("truncated queries increased by %d, want 1", got)
+	}
+}
@@ -0,0 +1,42 @@
+package gauges
+
+import (
+	"sync"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// Group is a set of gauges that is replaced as a whole on every collection.
+// Gauges that disappear are reset to zero, or unregistered if Remove is set,
+// instead of keeping their last value.
+type Group struct {
+	// Remove unregisters missing gauges, for per-object series that should vanish
+	Remove bool
+
+	mu    sync.Mutex
+	names map[string]bool
+}
+
+// Update sets every gauge in values and resets the ones set previously but missing now
+func (g *Group) Update(values map[string]float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.names == nil {
+		g.names = make(map[string]bool)
+	}
+	for name := range g.names {
+		if _, ok := values[name]; ok {
+			continue
+		}
+		if g.Remove {
+			metrics.UnregisterMetric(name)
+			delete(g.names, name)
+		} else {
+			metrics.GetOrCreateGauge(name, nil).Set(0)
+		}
+	}
+	for name, value := range values {
+		metrics.GetOrCreateGauge(name, nil).Set(value)
+		g.names[name] = true
+	}
+}
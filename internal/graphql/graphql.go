@@ -0,0 +1,111 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/vinistoisr/zerotrust-exporter/internal/appmetrics"
+	"github.com/vinistoisr/zerotrust-exporter/internal/config"
+)
+
+// DefaultEndpoint is the Cloudflare GraphQL Analytics API endpoint
+const DefaultEndpoint = "https://api.cloudflare.com/client/v4/graphql"
+
+// Client sends queries to a GraphQL endpoint authenticated with the configured API credentials
+type Client struct {
+	Endpoint   string
+	HTTPClient *http.Client
+}
+
+// Error is a single error returned in a GraphQL response
+type Error struct {
+	Message    string        `json:"message"`
+	Path       []interface{} `json:"path"`
+	Extensions struct {
+		Code string `json:"code"`
+	} `json:"extensions"`
+}
+
+// QueryError holds the errors returned in a GraphQL response
+type QueryError struct {
+	Errors []Error
+}
+
+func (e *QueryError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Message
+	}
+	return "query failed: " + strings.Join(messages, "; ")
+}
+
+// Unauthorized reports whether the API rejected the query because the token lacks permission
+func (e *QueryError) Unauthorized() bool {
+	for _, err := range e.Errors {
+		if err.Extensions.Code == "authz" {
+			return true
+		}
+	}
+	return false
+}
+
+type request struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+type response struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []Error         `json:"errors"`
+}
+
+// NewClient returns a client for endpoint, or for the Cloudflare endpoint if endpoint is empty
+func NewClient(endpoint string) *Client {
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	return &Client{Endpoint: endpoint, HTTPClient: http.DefaultClient}
+}
+
+// Query runs query with variables and decodes the data field of the response into result.
+// Errors returned by the API are reported even if partial data was returned.
+func (c *Client) Query(ctx context.Context, query string, variables map[string]interface{}, result interface{}) error {
+	body, err := json.Marshal(request{Query: query, Variables: variables})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	config.SetAuthHeaders(req)
+	req.Header.Set("Content-Type", "application/json")
+
+	appmetrics.IncApiCallCounter()
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected response: %s, response body: %s", resp.Status, string(bodyBytes))
+	}
+
+	var r response
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	if len(r.Errors) > 0 {
+		return &QueryError{Errors: r.Errors}
+	}
+	if len(r.Data) == 0 || string(r.Data) == "null" {
+		return fmt.Errorf("query returned no data")
+	}
+	return json.Unmarshal(r.Data, result)
+}
@@ -0,0 +1,108 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/vinistoisr/zerotrust-exporter/internal/config"
+)
+
+func TestQuery(t *testing.T) {
+	config.ApiKey = "token"
+
+	for _, tc := range []struct {
+		name   string
+		status int
+		body   string
+		err    string
+		value  int
+	}{
+		{
+			name:   "success",
+			status: http.StatusOK,
+			body:   `{"data": {"value": 42}, "errors": null}`,
+			value:  42,
+		},
+		{
+			name:   "http error",
+			status: http.StatusBadGateway,
+			body:   `bad gateway`,
+			err:    "502 Bad Gateway",
+		},
+		{
+			name:   "query errors",
+			status: http.StatusOK,
+			body:   `{"data": {"value": 1}, "errors": [{"message": "quota exceeded", "path": ["viewer", "accounts", 0, "queries"]}, {"message": "limit too high"}]}`,
+			err:    "query failed: quota exceeded; limit too high",
+		},
+		{
+			name:   "null data",
+			status: http.StatusOK,
+			body:   `{"data": null}`,
+			err:    "query returned no data",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost {
+					t.Errorf("method = %s, want POST", r.Method)
+				}
+				if got := r.Header.Get("Authorization"); got != "Bearer token" {
+					t.Errorf("Authorization = %q, want Bearer token", got)
+				}
+				var req request
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Fatalf("decoding request: %v", err)
+				}
+				if req.Query != "query { value }" || req.Variables["accountTag"] != "account" {
+					t.Errorf("unexpected request %+v", req)
+				}
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+
+			var result struct {
+				Value int `json:"value"`
+			}
+			err := NewClient(server.URL).Query(context.Background(), "query { value }", map[string]interface{}{"accountTag": "account"}, &result)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("error = %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Value != tc.value {
+				t.Errorf("value = %d, want %d", result.Value, tc.value)
+			}
+		})
+	}
+}
+
+func TestQueryErrorUnauthorized(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": null, "errors": [{"message": "not authorized for that account", "extensions": {"code": "authz"}}]}`))
+	}))
+	defer server.Close()
+
+	var result struct{}
+	err := NewClient(server.URL).Query(context.Background(), "query { value }", nil, &result)
+	var queryErr *QueryError
+	if !errors.As(err, &queryErr) || !queryErr.Unauthorized() {
+		t.Fatalf("error = %v, want an unauthorized query error", err)
+	}
+}
+
+func TestNewClientDefaultEndpoint(t *testing.T) {
+	if got := NewClient("").Endpoint; got != DefaultEndpoint {
+		t.Errorf("endpoint = %q, want %q", got, DefaultEndpoint)
+	}
+}
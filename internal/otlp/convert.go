@@ -0,0 +1,179 @@
+package otlp
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vinistoisr/zerotrust-exporter/internal/exposition"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// histogramPoint accumulates the bucket, sum and count series of a single histogram
+type histogramPoint struct {
+	attrs   attribute.Set
+	buckets []vmBucket
+	sum     float64
+	count   uint64
+}
+
+// vmBucket is a single VictoriaMetrics vmrange bucket
+type vmBucket struct {
+	upper float64
+	count uint64
+}
+
+// convert maps gathered samples to OTLP metrics.
+// Series ending in _total become cumulative monotonic sums, VictoriaMetrics
+// vmrange histograms become explicit bucket histograms and everything else is
+// exported as a gauge.
+func convert(samples []exposition.Sample, startTime, now time.Time) []metricdata.Metrics {
+	histograms := make(map[string]bool)
+	for _, sample := range samples {
+		if family, ok := strings.CutSuffix(sample.Name, "_bucket"); ok && hasLabel(sample, "vmrange") {
+			histograms[family] = true
+		}
+	}
+
+	var order []string
+	gauges := make(map[string][]metricdata.DataPoint[float64])
+	sums := make(map[string][]metricdata.DataPoint[float64])
+	points := make(map[string]map[attribute.Distinct]*histogramPoint)
+	seen := make(map[string]bool)
+
+	for _, sample := range samples {
+		family, suffix := histogramFamily(sample.Name, histograms)
+		if !seen[family] {
+			seen[family] = true
+			order = append(order, family)
+		}
+
+		if suffix != "" {
+			attrs := attributes(sample, "vmrange")
+			if points[family] == nil {
+				points[family] = make(map[attribute.Distinct]*histogramPoint)
+			}
+			p := points[family][attrs.Equivalent()]
+			if p == nil {
+				p = &histogramPoint{attrs: attrs}
+				points[family][attrs.Equivalent()] = p
+			}
+			switch suffix {
+			case "_bucket":
+				p.buckets = append(p.buckets, vmBucket{upper: vmrangeUpper(labelValue(sample, "vmrange")), count: uint64(sample.Value)})
+			case "_sum":
+				p.sum = sample.Value
+			case "_count":
+				p.count = uint64(sample.Value)
+			}
+			continue
+		}
+
+		dp := metricdata.DataPoint[float64]{Attributes: attributes(sample), StartTime: startTime, Time: now, Value: sample.Value}
+		if strings.HasSuffix(family, "_total") {
+			sums[family] = append(sums[family], dp)
+		} else {
+			gauges[family] = append(gauges[family], dp)
+		}
+	}
+
+	result := make([]metricdata.Metrics, 0, len(order))
+	for _, family := range order {
+		switch {
+		case points[family] != nil:
+			result = append(result, metricdata.Metrics{Name: family, Data: histogram(points[family], startTime, now)})
+		case sums[family] != nil:
+			result = append(result, metricdata.Metrics{Name: family, Data: metricdata.Sum[float64]{
+				DataPoints:  sums[family],
+				Temporality: metricdata.CumulativeTemporality,
+				IsMonotonic: true,
+			}})
+		default:
+			result = append(result, metricdata.Metrics{Name: family, Data: metricdata.Gauge[float64]{DataPoints: gauges[family]}})
+		}
+	}
+	return result
+}
+
+// histogram builds an explicit bucket histogram from sparse vmrange buckets.
+// Empty ranges between reported buckets have a zero count, so each bucket's
+// upper edge can be used directly as an explicit bound.
+func histogram(points map[attribute.Distinct]*histogramPoint, startTime, now time.Time) metricdata.Histogram[float64] {
+	h := metricdata.Histogram[float64]{Temporality: metricdata.CumulativeTemporality}
+	for _, p := range points {
+		sort.Slice(p.buckets, func(i, j int) bool { return p.buckets[i].upper < p.buckets[j].upper })
+		dp := metricdata.HistogramDataPoint[float64]{
+			Attributes: p.attrs,
+			StartTime:  startTime,
+			Time:       now,
+			Count:      p.count,
+			Sum:        p.sum,
+		}
+		var overflow uint64
+		for _, b := range p.buckets {
+			if math.IsInf(b.upper, 1) {
+				overflow += b.count
+				continue
+			}
+			dp.Bounds = append(dp.Bounds, b.upper)
+			dp.BucketCounts = append(dp.BucketCounts, b.count)
+		}
+		dp.BucketCounts = append(dp.BucketCounts, overflow)
+		h.DataPoints = append(h.DataPoints, dp)
+	}
+	return h
+}
+
+// histogramFamily returns the histogram family and series suffix for name, or name itself if it is not part of a histogram
+func histogramFamily(name string, histograms map[string]bool) (string, string) {
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		if family, ok := strings.CutSuffix(name, suffix); ok && histograms[family] {
+			return family, suffix
+		}
+	}
+	return name, ""
+}
+
+// vmrangeUpper parses the upper bound of a "start...end" vmrange label
+func vmrangeUpper(vmrange string) float64 {
+	_, end, _ := strings.Cut(vmrange, "...")
+	upper, err := strconv.ParseFloat(end, 64)
+	if err != nil {
+		return math.Inf(1)
+	}
+	return upper
+}
+
+// attributes converts sample labels to OTLP attributes, skipping the excluded label names
+func attributes(sample exposition.Sample, exclude ...string) attribute.Set {
+	kvs := make([]attribute.KeyValue, 0, len(sample.Labels))
+	for _, l := range sample.Labels {
+		if slices.Contains(exclude, l.Name) {
+			continue
+		}
+		kvs = append(kvs, attribute.String(l.Name, l.Value))
+	}
+	return attribute.NewSet(kvs...)
+}
+
+func hasLabel(sample exposition.Sample, name string) bool {
+	for _, l := range sample.Labels {
+		if l.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func labelValue(sample exposition.Sample, name string) string {
+	for _, l := range sample.Labels {
+		if l.Name == name {
+			return l.Value
+		}
+	}
+	return ""
+}
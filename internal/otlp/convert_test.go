@@ -0,0 +1,93 @@
+package otlp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vinistoisr/zerotrust-exporter/internal/exposition"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata/metricdatatest"
+)
+
+func sample(name string, value float64, labels ...string) exposition.Sample {
+	s := exposition.Sample{Name: name, Value: value}
+	for i := 0; i+1 < len(labels); i += 2 {
+		s.Labels = append(s.Labels, exposition.Label{Name: labels[i], Value: labels[i+1]})
+	}
+	return s
+}
+
+func TestConvert(t *testing.T) {
+	startTime := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	now := startTime.Add(time.Minute)
+	status := attribute.NewSet(attribute.String("status", "connected"))
+
+	for _, tc := range []struct {
+		name    string
+		samples []exposition.Sample
+		want    []metricdata.Metrics
+	}{
+		{
+			name:    "counter",
+			samples: []exposition.Sample{sample("zerotrust_exporter_api_calls_total", 12)},
+			want: []metricdata.Metrics{{
+				Name: "zerotrust_exporter_api_calls_total",
+				Data: metricdata.Sum[float64]{
+					DataPoints:  []metricdata.DataPoint[float64]{{Attributes: *attribute.EmptySet(), StartTime: startTime, Time: now, Value: 12}},
+					Temporality: metricdata.CumulativeTemporality,
+					IsMonotonic: true,
+				},
+			}},
+		},
+		{
+			name: "gauge",
+			samples: []exposition.Sample{
+				sample("zerotrust_devices_by_status", 3, "status", "connected"),
+				sample("zerotrust_devices_by_status", 1, "status", "disconnected"),
+			},
+			want: []metricdata.Metrics{{
+				Name: "zerotrust_devices_by_status",
+				Data: metricdata.Gauge[float64]{DataPoints: []metricdata.DataPoint[float64]{
+					{Attributes: status, StartTime: startTime, Time: now, Value: 3},
+					{Attributes: attribute.NewSet(attribute.String("status", "disconnected")), StartTime: startTime, Time: now, Value: 1},
+				}},
+			}},
+		},
+		{
+			name: "vmrange histogram",
+			samples: []exposition.Sample{
+				sample("zerotrust_exporter_scrape_duration_seconds_bucket", 2, "status", "connected", "vmrange", "1.000e+00...1.136e+00"),
+				sample("zerotrust_exporter_scrape_duration_seconds_bucket", 1, "status", "connected", "vmrange", "8.799e-01...1.000e+00"),
+				sample("zerotrust_exporter_scrape_duration_seconds_bucket", 1, "status", "connected", "vmrange", "1.000e+18...+Inf"),
+				sample("zerotrust_exporter_scrape_duration_seconds_sum", 4.5, "status", "connected"),
+				sample("zerotrust_exporter_scrape_duration_seconds_count", 4, "status", "connected"),
+			},
+			want: []metricdata.Metrics{{
+				Name: "zerotrust_exporter_scrape_duration_seconds",
+				Data: metricdata.Histogram[float64]{
+					Temporality: metricdata.CumulativeTemporality,
+					DataPoints: []metricdata.HistogramDataPoint[float64]{{
+						Attributes:   status,
+						StartTime:    startTime,
+						Time:         now,
+						Count:        4,
+						Sum:          4.5,
+						Bounds:       []float64{1, 1.136},
+						BucketCounts: []uint64{1, 2, 1},
+					}},
+				},
+			}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := convert(tc.samples, startTime, now)
+			if len(got) != len(tc.want) {
+				t.Fatalf("got %d metrics, want %d: %+v", len(got), len(tc.want), got)
+			}
+			for i := range got {
+				metricdatatest.AssertEqual(t, tc.want[i], got[i])
+			}
+		})
+	}
+}
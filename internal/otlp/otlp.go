@@ -0,0 +1,134 @@
+package otlp
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/vinistoisr/zerotrust-exporter/internal/config"
+	"github.com/vinistoisr/zerotrust-exporter/internal/exposition"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// exporter is the subset of the OTLP metric exporters used here
+type exporter interface {
+	Export(ctx context.Context, rm *metricdata.ResourceMetrics) error
+	Shutdown(ctx context.Context) error
+}
+
+// newExporter creates a gRPC or HTTP OTLP exporter based on config.OTLPProtocol
+func newExporter(ctx context.Context) (exporter, error) {
+	headers := parseHeaders(config.OTLPHeaders)
+	switch config.OTLPProtocol {
+	case "grpc":
+		opts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithTimeout(config.OTLPTimeout)}
+		if config.OTLPEndpoint != "" {
+			opts = append(opts, otlpmetricgrpc.WithEndpointURL(config.OTLPEndpoint))
+		}
+		if len(headers) > 0 {
+			opts = append(opts, otlpmetricgrpc.WithHeaders(headers))
+		}
+		return otlpmetricgrpc.New(ctx, opts...)
+	case "http":
+		opts := []otlpmetrichttp.Option{otlpmetrichttp.WithTimeout(config.OTLPTimeout)}
+		if config.OTLPEndpoint != "" {
+			opts = append(opts, otlpmetrichttp.WithEndpointURL(config.OTLPEndpoint))
+		}
+		if len(headers) > 0 {
+			opts = append(opts, otlpmetrichttp.WithHeaders(headers))
+		}
+		return otlpmetrichttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unsupported OTLP protocol %q, expected grpc or http", config.OTLPProtocol)
+	}
+}
+
+// Start collects metrics on every interval and exports them via OTLP until ctx is cancelled.
+// If the exporter cannot be created, creating it is retried on the next interval.
+func Start(ctx context.Context, collect func(context.Context)) {
+	var exp exporter
+	defer func() {
+		if exp != nil {
+			exp.Shutdown(context.Background())
+		}
+	}()
+
+	res := resource.NewSchemaless(
+		attribute.String("service.name", "zerotrust-exporter"),
+		attribute.String("cloudflare.account.id", config.AccountID),
+	)
+	startTime := time.Now()
+
+	log.Printf("Exporting metrics via OTLP/%s every %v", config.OTLPProtocol, config.OTLPInterval)
+	ticker := time.NewTicker(config.OTLPInterval)
+	defer ticker.Stop()
+	for {
+		if exp == nil {
+			var err error
+			if exp, err = newExporter(ctx); err != nil {
+				log.Printf("Error creating OTLP exporter, retrying in %v: %v", config.OTLPInterval, err)
+				exp = nil
+			}
+		}
+		if exp != nil {
+			export(ctx, exp, res, startTime, collect)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// export runs a collection and sends the zerotrust_* metrics to the collector
+func export(ctx context.Context, exp exporter, res *resource.Resource, startTime time.Time, collect func(context.Context)) {
+	collect(ctx)
+	samples, err := exposition.Gather()
+	if err != nil {
+		log.Printf("Error gathering metrics for OTLP: %v", err)
+		return
+	}
+
+	filtered := samples[:0]
+	for _, sample := range samples {
+		if strings.HasPrefix(sample.Name, "zerotrust_") {
+			filtered = append(filtered, sample)
+		}
+	}
+
+	rm := &metricdata.ResourceMetrics{
+		Resource: res,
+		ScopeMetrics: []metricdata.ScopeMetrics{{
+			Scope:   instrumentation.Scope{Name: "github.com/vinistoisr/zerotrust-exporter"},
+			Metrics: convert(filtered, startTime, time.Now()),
+		}},
+	}
+	if err := exp.Export(ctx, rm); err != nil {
+		log.Printf("Error exporting metrics via OTLP: %v", err)
+		return
+	}
+	if config.Debug {
+		log.Printf("Exported %d metrics via OTLP", len(rm.ScopeMetrics[0].Metrics))
+	}
+}
+
+// parseHeaders parses a comma separated list of key=value pairs
+func parseHeaders(s string) map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return headers
+}
@@ -0,0 +1,99 @@
+package posture
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go"
+	"github.com/vinistoisr/zerotrust-exporter/internal/appmetrics"
+	"github.com/vinistoisr/zerotrust-exporter/internal/config"
+	"github.com/vinistoisr/zerotrust-exporter/internal/exposition"
+	"github.com/vinistoisr/zerotrust-exporter/internal/gauges"
+)
+
+var (
+	// integrationGauges holds the per-integration series, removed when an integration is deleted
+	integrationGauges = gauges.Group{Remove: true}
+
+	lastPassMu sync.Mutex
+	// lastPass is when this process last observed a device passing a rule backed by each integration.
+	// It is kept in memory only, so it is missing after a restart until a pass is observed again.
+	lastPass = make(map[string]time.Time)
+)
+
+// FetchIntegrations fetches all device posture integrations from Cloudflare API
+func FetchIntegrations(ctx context.Context) ([]cloudflare.DevicePostureIntegration, error) {
+	integrations, _, err := config.GetClient().DevicePostureIntegrations(ctx, config.AccountID)
+	return integrations, err
+}
+
+// collectIntegrationMetrics reports the health of the posture integrations. An integration is
+// considered in sync while at least one device passes a posture rule that uses it.
+func collectIntegrationMetrics(ctx context.Context, rules []cloudflare.DevicePostureRule, results map[string]map[string]Result) {
+	appmetrics.IncApiCallCounter()
+	integrations, err := FetchIntegrations(ctx)
+	if err != nil {
+		log.Printf("Error fetching device posture integrations: %v", err)
+		appmetrics.IncApiErrorsCounter()
+		appmetrics.SetUpMetric(0)
+		return
+	}
+
+	// Map the rules backed by an integration to the integration ID
+	ruleIntegration := make(map[string]string)
+	ruleCounts := make(map[string]int)
+	for _, rule := range rules {
+		if rule.Input.ConnectionID != "" {
+			ruleIntegration[rule.ID] = rule.Input.ConnectionID
+			ruleCounts[rule.Input.ConnectionID]++
+		}
+	}
+
+	// Count the devices passing at least one rule of each integration
+	passing := make(map[string]int)
+	for _, deviceResults := range results {
+		passed := make(map[string]bool)
+		for ruleID, result := range deviceResults {
+			if integrationID, ok := ruleIntegration[ruleID]; ok && result.Success {
+				passed[integrationID] = true
+			}
+		}
+		for integrationID := range passed {
+			passing[integrationID]++
+		}
+	}
+
+	now := time.Now()
+	values := make(map[string]float64)
+	lastPassMu.Lock()
+	defer lastPassMu.Unlock()
+	for _, integration := range integrations {
+		id := integration.IntegrationID
+		values[fmt.Sprintf(`zerotrust_posture_integration_info{integration_id="%s", name="%s", type="%s"}`, id, exposition.EscapeLabelValue(integration.Name), integration.Type)] = 1
+
+		configured := 0.0
+		if integration.Config.ClientID != "" || integration.Config.ApiUrl != "" || integration.Config.CustomerID != "" {
+			configured = 1
+		}
+		values[fmt.Sprintf(`zerotrust_posture_integration_configured{integration_id="%s"}`, id)] = configured
+
+		if interval, err := time.ParseDuration(integration.Interval); err == nil {
+			values[fmt.Sprintf(`zerotrust_posture_integration_interval_seconds{integration_id="%s"}`, id)] = interval.Seconds()
+		} else if config.Debug {
+			log.Printf("Error parsing interval %q of posture integration %s: %v", integration.Interval, id, err)
+		}
+
+		values[fmt.Sprintf(`zerotrust_posture_integration_rules{integration_id="%s"}`, id)] = float64(ruleCounts[id])
+		values[fmt.Sprintf(`zerotrust_posture_integration_passing_devices{integration_id="%s"}`, id)] = float64(passing[id])
+		if passing[id] > 0 {
+			lastPass[id] = now
+		}
+		if t, ok := lastPass[id]; ok {
+			values[fmt.Sprintf(`zerotrust_posture_integration_last_observed_pass_timestamp_seconds{integration_id="%s"}`, id)] = float64(t.Unix())
+		}
+	}
+	integrationGauges.Update(values)
+}
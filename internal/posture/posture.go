@@ -0,0 +1,240 @@
+package posture
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go"
+	"github.com/vinistoisr/zerotrust-exporter/internal/appmetrics"
+	"github.com/vinistoisr/zerotrust-exporter/internal/config"
+	"github.com/vinistoisr/zerotrust-exporter/internal/exposition"
+	"github.com/vinistoisr/zerotrust-exporter/internal/gauges"
+	"github.com/vinistoisr/zerotrust-exporter/internal/registrations"
+)
+
+// workers is the number of devices whose posture results are fetched concurrently
+const workers = 4
+
+// Result is the latest result of a single posture rule on a device
+type Result struct {
+	RuleID   string `json:"id"`
+	RuleName string `json:"rule_name"`
+	Type     string `json:"type"`
+	Success  bool   `json:"success"`
+}
+
+type resultsResponse struct {
+	Result  map[string]Result `json:"result"`
+	Success bool              `json:"success"`
+}
+
+var (
+	// ruleGauges holds the pass and fail counts per rule
+	ruleGauges gauges.Group
+	// failureGauges holds the per-device failures, removed once the device passes
+	failureGauges = gauges.Group{Remove: true}
+
+	resultsMu sync.Mutex
+	// latestResults holds the last results fetched per device. With PostureMaxDevices set only
+	// some devices are fetched per collection, the others keep their results from earlier ones.
+	latestResults = make(map[string]map[string]Result)
+	// nextDevice is the position in the device list where the next collection starts fetching
+	nextDevice int
+)
+
+// FetchRules fetches all device posture rules from Cloudflare API
+func FetchRules(ctx context.Context) ([]cloudflare.DevicePostureRule, error) {
+	rules, _, err := config.GetClient().DevicePostureRules(ctx, config.AccountID)
+	return rules, err
+}
+
+// FetchDeviceResults fetches the latest posture results of a device keyed by rule ID
+func FetchDeviceResults(ctx context.Context, deviceID string) (map[string]Result, error) {
+	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/devices/%s/posture/check", config.AccountID, deviceID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	config.SetAuthHeaders(req)
+	req.Header.Set("Content-Type", "application/json")
+
+	appmetrics.IncApiCallCounter()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching posture results: %s", resp.Status)
+	}
+
+	var response resultsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("error decoding posture results: %w", err)
+	}
+	for ruleID, result := range response.Result {
+		if result.RuleID == "" {
+			result.RuleID = ruleID
+			response.Result[ruleID] = result
+		}
+	}
+	return response.Result, nil
+}
+
+// fetchAllResults fetches the posture results of the given devices with a small worker pool.
+// Devices whose results cannot be fetched are left out.
+func fetchAllResults(ctx context.Context, deviceIDs []string) (map[string]map[string]Result, int) {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]map[string]Result, len(deviceIDs))
+		failed  int
+	)
+	ids := make(chan string)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for deviceID := range ids {
+				deviceResults, err := FetchDeviceResults(ctx, deviceID)
+				mu.Lock()
+				if err != nil {
+					failed++
+					if config.Debug {
+						log.Printf("Error fetching posture results for device %s: %v", deviceID, err)
+					}
+				} else {
+					results[deviceID] = deviceResults
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, deviceID := range deviceIDs {
+		ids <- deviceID
+	}
+	close(ids)
+	wg.Wait()
+	return results, failed
+}
+
+// rotate returns up to max of the device IDs, continuing after the devices returned by the
+// previous call so every device is eventually fetched. max of 0 returns all devices.
+func rotate(deviceIDs []string, max int) []string {
+	if max == 0 || len(deviceIDs) <= max {
+		nextDevice = 0
+		return deviceIDs
+	}
+	start := nextDevice % len(deviceIDs)
+	selected := make([]string, 0, max)
+	for i := 0; i < max; i++ {
+		selected = append(selected, deviceIDs[(start+i)%len(deviceIDs)])
+	}
+	nextDevice = (start + max) % len(deviceIDs)
+	return selected
+}
+
+// CollectPostureMetrics collects posture rule results for the registered devices
+func CollectPostureMetrics(ctx context.Context) {
+	startTime := time.Now()
+	appmetrics.IncApiCallCounter()
+	rules, err := FetchRules(ctx)
+	if err != nil {
+		log.Printf("Error fetching device posture rules: %v", err)
+		appmetrics.IncApiErrorsCounter()
+		appmetrics.SetUpMetric(0)
+		return
+	}
+
+	appmetrics.IncApiCallCounter()
+	devices, err := registrations.FetchRegistrations(ctx)
+	if err != nil {
+		log.Printf("Error fetching registered devices: %v", err)
+		appmetrics.IncApiErrorsCounter()
+		appmetrics.SetUpMetric(0)
+		return
+	}
+	var active []string
+	for _, device := range devices {
+		if !device.Deleted && device.RevokedAt == "" {
+			active = append(active, device.ID)
+		}
+	}
+
+	resultsMu.Lock()
+	defer resultsMu.Unlock()
+	first := nextDevice
+	deviceIDs := rotate(active, config.PostureMaxDevices)
+	skipped := len(active) - len(deviceIDs)
+	if skipped > 0 && config.Debug {
+		log.Printf("Fetching posture results for %d of %d active registered devices, starting at device %d", len(deviceIDs), len(active), first)
+	}
+
+	fetched, failed := fetchAllResults(ctx, deviceIDs)
+	if failed > 0 {
+		log.Printf("Error fetching posture results for %d of %d devices", failed, len(deviceIDs))
+		appmetrics.IncApiErrorsCounter()
+		appmetrics.SetUpMetric(0)
+	}
+
+	// Keep the results of the active devices not fetched this time
+	isActive := make(map[string]bool, len(active))
+	for _, deviceID := range active {
+		isActive[deviceID] = true
+	}
+	for deviceID := range latestResults {
+		if !isActive[deviceID] {
+			delete(latestResults, deviceID)
+		}
+	}
+	for deviceID, deviceResults := range fetched {
+		latestResults[deviceID] = deviceResults
+	}
+	results := latestResults
+
+	if config.Debug {
+		log.Printf("Fetched %d posture rules and results for %d devices in %v", len(rules), len(results), time.Since(startTime))
+	}
+
+	// Every rule is reported, even if no device has a result for it yet
+	counts := make(map[string]float64)
+	rulesByID := make(map[string]cloudflare.DevicePostureRule, len(rules))
+	for _, rule := range rules {
+		rulesByID[rule.ID] = rule
+		for _, result := range []string{"pass", "fail"} {
+			counts[fmt.Sprintf(`zerotrust_posture_rule_results{rule_id="%s", rule_name="%s", rule_type="%s", result="%s"}`, rule.ID, exposition.EscapeLabelValue(rule.Name), rule.Type, result)] = 0
+		}
+	}
+
+	failures := make(map[string]float64)
+	for deviceID, deviceResults := range results {
+		for ruleID, result := range deviceResults {
+			rule, ok := rulesByID[ruleID]
+			if !ok {
+				// Results of rules deleted since the device last checked in
+				continue
+			}
+			outcome := "pass"
+			if !result.Success {
+				outcome = "fail"
+			}
+			counts[fmt.Sprintf(`zerotrust_posture_rule_results{rule_id="%s", rule_name="%s", rule_type="%s", result="%s"}`, rule.ID, exposition.EscapeLabelValue(rule.Name), rule.Type, outcome)]++
+
+			if !result.Success && !config.DevicesAggregateOnly {
+				failures[fmt.Sprintf(`zerotrust_device_posture_failed{device_id="%s", rule_id="%s", rule_name="%s"}`, deviceID, rule.ID, exposition.EscapeLabelValue(rule.Name))] = 1
+			}
+		}
+	}
+	counts["zerotrust_posture_devices_checked"] = float64(len(results))
+	counts["zerotrust_posture_devices_failed"] = float64(failed)
+	counts["zerotrust_posture_devices_skipped"] = float64(skipped)
+	ruleGauges.Update(counts)
+	failureGauges.Update(failures)
+
+	collectIntegrationMetrics(ctx, rules, results)
+}
@@ -0,0 +1,120 @@
+package registrations
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go"
+	"github.com/vinistoisr/zerotrust-exporter/internal/appmetrics"
+	"github.com/vinistoisr/zerotrust-exporter/internal/config"
+	"github.com/vinistoisr/zerotrust-exporter/internal/devices"
+	"github.com/vinistoisr/zerotrust-exporter/internal/exposition"
+	"github.com/vinistoisr/zerotrust-exporter/internal/gauges"
+)
+
+var (
+	// countGauges holds the inventory counts per device type
+	countGauges gauges.Group
+	// deviceGauges holds the per-device series, removed when a registration is deleted
+	deviceGauges = gauges.Group{Remove: true}
+	// fleetGauges holds the join with the fleet status, removed when the fleet status cannot be fetched
+	fleetGauges = gauges.Group{Remove: true}
+)
+
+// FetchRegistrations fetches all registered devices from Cloudflare API
+func FetchRegistrations(ctx context.Context) ([]cloudflare.TeamsDeviceListItem, error) {
+	return config.GetClient().ListTeamsDevices(ctx, config.AccountID)
+}
+
+// CollectRegistrationMetrics collects inventory metrics for registered devices
+func CollectRegistrationMetrics(ctx context.Context) {
+	appmetrics.IncApiCallCounter()
+	startTime := time.Now()
+	registrations, err := FetchRegistrations(ctx)
+	if err != nil {
+		log.Printf("Error fetching registered devices: %v", err)
+		appmetrics.IncApiErrorsCounter()
+		appmetrics.SetUpMetric(0)
+		return
+	}
+
+	if config.Debug {
+		log.Printf("Fetched %d registered devices in %v", len(registrations), time.Since(startTime))
+	}
+
+	// Join with the fleet status to find registered devices that are not checking in
+	statuses, err := devices.FetchDeviceStatus(ctx, config.AccountID, "")
+	if err != nil {
+		log.Printf("Error fetching device status for registrations: %v", err)
+		appmetrics.IncApiErrorsCounter()
+		appmetrics.SetUpMetric(0)
+	}
+
+	now := time.Now()
+	counts := make(map[string]float64)
+	perDevice := make(map[string]float64)
+	fleet := make(map[string]float64)
+	for _, device := range registrations {
+		if device.Deleted {
+			continue
+		}
+		revoked := device.RevokedAt != ""
+		lastSeen, lastSeenErr := time.Parse(time.RFC3339Nano, device.LastSeen)
+
+		// Every device type present is reported, even with no stale or revoked devices
+		active := fmt.Sprintf(`zerotrust_registrations{device_type="%s"}`, device.DeviceType)
+		stale := fmt.Sprintf(`zerotrust_registrations_stale{device_type="%s"}`, device.DeviceType)
+		revokedName := fmt.Sprintf(`zerotrust_registrations_revoked{device_type="%s"}`, device.DeviceType)
+		counts[active] += 0
+		counts[stale] += 0
+		counts[revokedName] += 0
+		switch {
+		case revoked:
+			counts[revokedName]++
+		case lastSeenErr == nil && now.Sub(lastSeen) > config.RegistrationsStaleAfter:
+			counts[active]++
+			counts[stale]++
+		default:
+			counts[active]++
+		}
+
+		connected := 0.0
+		if statuses != nil && !revoked {
+			notSeen := fmt.Sprintf(`zerotrust_registrations_not_seen{device_type="%s"}`, device.DeviceType)
+			notConnected := fmt.Sprintf(`zerotrust_registrations_not_connected{device_type="%s"}`, device.DeviceType)
+			fleet[notSeen] += 0
+			fleet[notConnected] += 0
+			status, seen := statuses[device.ID]
+			switch {
+			case !seen:
+				fleet[notSeen]++
+				fleet[notConnected]++
+			case !devices.IsUp(status, now):
+				fleet[notConnected]++
+			default:
+				connected = 1
+			}
+		}
+
+		if config.DevicesAggregateOnly {
+			continue
+		}
+		perDevice[fmt.Sprintf(`zerotrust_registration_info{device_id="%s", device_name="%s", device_type="%s", model="%s", manufacturer="%s", os_version="%s", serial_number="%s", version="%s", user_email="%s", revoked="%t"}`,
+			device.ID, exposition.EscapeLabelValue(device.Name), device.DeviceType, exposition.EscapeLabelValue(device.Model), exposition.EscapeLabelValue(device.Manufacturer),
+			exposition.EscapeLabelValue(device.OSVersion), exposition.EscapeLabelValue(device.SerialNumber), exposition.EscapeLabelValue(device.Version), exposition.EscapeLabelValue(device.User.Email), revoked)] = 1
+		if statuses != nil && !revoked {
+			fleet[fmt.Sprintf(`zerotrust_registration_connected{device_id="%s"}`, device.ID)] = connected
+		}
+		if lastSeenErr == nil {
+			perDevice[fmt.Sprintf(`zerotrust_registration_last_seen_timestamp_seconds{device_id="%s"}`, device.ID)] = float64(lastSeen.Unix())
+		}
+		if created, err := time.Parse(time.RFC3339Nano, device.Created); err == nil {
+			perDevice[fmt.Sprintf(`zerotrust_registration_created_timestamp_seconds{device_id="%s"}`, device.ID)] = float64(created.Unix())
+		}
+	}
+	countGauges.Update(counts)
+	deviceGauges.Update(perDevice)
+	fleetGauges.Update(fleet)
+}
@@ -0,0 +1,55 @@
+package remotewrite
+
+import (
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// prompbLabel mirrors prometheus.Label from the remote-write protobuf schema
+type prompbLabel struct {
+	Name  string
+	Value string
+}
+
+// timeSeries mirrors prometheus.TimeSeries with a single sample
+type timeSeries struct {
+	Labels    []prompbLabel
+	Value     float64
+	Timestamp int64
+}
+
+// marshalWriteRequest encodes series as a prometheus.WriteRequest message
+func marshalWriteRequest(series []timeSeries) []byte {
+	var b []byte
+	for _, ts := range series {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, marshalTimeSeries(ts))
+	}
+	return b
+}
+
+// marshalTimeSeries encodes a prometheus.TimeSeries message
+func marshalTimeSeries(ts timeSeries) []byte {
+	var b []byte
+	for _, l := range ts.Labels {
+		var lb []byte
+		lb = protowire.AppendTag(lb, 1, protowire.BytesType)
+		lb = protowire.AppendString(lb, l.Name)
+		lb = protowire.AppendTag(lb, 2, protowire.BytesType)
+		lb = protowire.AppendString(lb, l.Value)
+
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, lb)
+	}
+
+	var sb []byte
+	sb = protowire.AppendTag(sb, 1, protowire.Fixed64Type)
+	sb = protowire.AppendFixed64(sb, math.Float64bits(ts.Value))
+	sb = protowire.AppendTag(sb, 2, protowire.VarintType)
+	sb = protowire.AppendVarint(sb, uint64(ts.Timestamp))
+
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendBytes(b, sb)
+	return b
+}
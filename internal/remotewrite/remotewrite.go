@@ -0,0 +1,170 @@
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/vinistoisr/zerotrust-exporter/internal/appmetrics"
+	"github.com/vinistoisr/zerotrust-exporter/internal/config"
+	"github.com/vinistoisr/zerotrust-exporter/internal/exposition"
+)
+
+const (
+	flushInterval = 5 * time.Second
+	maxBackoff    = 30 * time.Second
+)
+
+// Start collects metrics on every interval and pushes them to the remote write URL until ctx is cancelled
+func Start(ctx context.Context, collect func(context.Context)) {
+	queue := make(chan timeSeries, config.RemoteWriteQueueSize)
+	client := &http.Client{Timeout: config.RemoteWriteTimeout}
+	go send(ctx, client, queue)
+
+	log.Printf("Pushing metrics to %s every %v", config.RemoteWriteURL, config.RemoteWriteInterval)
+	ticker := time.NewTicker(config.RemoteWriteInterval)
+	defer ticker.Stop()
+	for {
+		enqueue(ctx, collect, queue)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// enqueue runs a collection and queues the resulting samples, dropping them if the queue is full
+func enqueue(ctx context.Context, collect func(context.Context), queue chan<- timeSeries) {
+	collect(ctx)
+	samples, err := exposition.Gather()
+	if err != nil {
+		log.Printf("Error gathering metrics for remote write: %v", err)
+		return
+	}
+
+	timestamp := time.Now().UnixMilli()
+	dropped := 0
+	for _, sample := range samples {
+		select {
+		case queue <- toTimeSeries(sample, timestamp):
+		default:
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		log.Printf("Remote write queue full, dropped %d samples", dropped)
+		appmetrics.RemoteWriteSamplesDropped.Add(dropped)
+	}
+	appmetrics.RemoteWriteQueueLength.Set(float64(len(queue)))
+}
+
+// send drains the queue in batches of up to RemoteWriteBatchSize samples
+func send(ctx context.Context, client *http.Client, queue <-chan timeSeries) {
+	batch := make([]timeSeries, 0, config.RemoteWriteBatchSize)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ts := <-queue:
+			batch = append(batch, ts)
+			if len(batch) < config.RemoteWriteBatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		sendBatch(ctx, client, batch)
+		batch = batch[:0]
+		appmetrics.RemoteWriteQueueLength.Set(float64(len(queue)))
+	}
+}
+
+// sendBatch pushes a single batch, retrying with exponential backoff on recoverable errors
+func sendBatch(ctx context.Context, client *http.Client, batch []timeSeries) {
+	body := snappy.Encode(nil, marshalWriteRequest(batch))
+	backoff := 500 * time.Millisecond
+
+	for attempt := 0; attempt <= config.RemoteWriteMaxRetries; attempt++ {
+		if attempt > 0 {
+			appmetrics.RemoteWriteRetries.Inc()
+			select {
+			case <-ctx.Done():
+				appmetrics.RemoteWriteSamplesFailed.Add(len(batch))
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, maxBackoff)
+		}
+
+		retry, err := post(ctx, client, body)
+		if err == nil {
+			appmetrics.RemoteWriteSamplesSent.Add(len(batch))
+			if config.Debug {
+				log.Printf("Pushed %d samples to remote write", len(batch))
+			}
+			return
+		}
+		log.Printf("Error pushing %d samples to remote write (attempt %d): %v", len(batch), attempt+1, err)
+		if !retry {
+			break
+		}
+	}
+	appmetrics.RemoteWriteSamplesFailed.Add(len(batch))
+}
+
+// post sends an encoded write request and reports whether a failure is worth retrying
+func post(ctx context.Context, client *http.Client, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.RemoteWriteURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "zerotrust-exporter")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if config.RemoteWriteBearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+config.RemoteWriteBearerToken)
+	} else if config.RemoteWriteUsername != "" {
+		req.SetBasicAuth(config.RemoteWriteUsername, config.RemoteWritePassword)
+	}
+
+	startTime := time.Now()
+	resp, err := client.Do(req)
+	appmetrics.RemoteWriteRequests.Inc()
+	appmetrics.RemoteWriteSendDuration.UpdateDuration(startTime)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+	bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err = fmt.Errorf("remote write returned %s, response body: %s", resp.Status, string(bodyBytes))
+	// Server errors and rate limiting are recoverable, other client errors are not
+	return resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests, err
+}
+
+// toTimeSeries converts a gathered sample into a remote write series with sorted labels
+func toTimeSeries(sample exposition.Sample, timestamp int64) timeSeries {
+	labels := make([]prompbLabel, 0, len(sample.Labels)+1)
+	labels = append(labels, prompbLabel{Name: "__name__", Value: sample.Name})
+	for _, l := range sample.Labels {
+		labels = append(labels, prompbLabel{Name: l.Name, Value: l.Value})
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+	return timeSeries{Labels: labels, Value: sample.Value, Timestamp: timestamp}
+}
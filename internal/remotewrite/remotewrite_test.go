@@ -0,0 +1,174 @@
+package remotewrite
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/vinistoisr/zerotrust-exporter/internal/config"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// consumeFields calls fn for each field of a protobuf message, failing the test on malformed input
+func consumeFields(t *testing.T, b []byte, fn func(num protowire.Number, typ protowire.Type, b []byte) int) {
+	t.Helper()
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("invalid tag: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		n = fn(num, typ, b)
+		if n < 0 {
+			t.Fatalf("invalid field %d: %v", num, protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+}
+
+// unmarshalWriteRequest decodes a prometheus.WriteRequest message following the remote write schema
+func unmarshalWriteRequest(t *testing.T, b []byte) []timeSeries {
+	var series []timeSeries
+	consumeFields(t, b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		if num != 1 || typ != protowire.BytesType {
+			t.Fatalf("unexpected write request field %d of type %v", num, typ)
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n >= 0 {
+			series = append(series, unmarshalTimeSeries(t, v))
+		}
+		return n
+	})
+	return series
+}
+
+func unmarshalTimeSeries(t *testing.T, b []byte) timeSeries {
+	var ts timeSeries
+	samples := 0
+	consumeFields(t, b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return n
+		}
+		switch num {
+		case 1:
+			var l prompbLabel
+			consumeFields(t, v, func(num protowire.Number, typ protowire.Type, b []byte) int {
+				s, n := protowire.ConsumeString(b)
+				switch num {
+				case 1:
+					l.Name = s
+				case 2:
+					l.Value = s
+				default:
+					t.Fatalf("unexpected label field %d", num)
+				}
+				return n
+			})
+			ts.Labels = append(ts.Labels, l)
+		case 2:
+			samples++
+			consumeFields(t, v, func(num protowire.Number, typ protowire.Type, b []byte) int {
+				switch num {
+				case 1:
+					bits, n := protowire.ConsumeFixed64(b)
+					ts.Value = math.Float64frombits(bits)
+					return n
+				case 2:
+					value, n := protowire.ConsumeVarint(b)
+					ts.Timestamp = int64(value)
+					return n
+				}
+				t.Fatalf("unexpected sample field %d", num)
+				return -1
+			})
+		default:
+			t.Fatalf("unexpected time series field %d", num)
+		}
+		return n
+	})
+	if samples != 1 {
+		t.Fatalf("expected one sample per series, got %d", samples)
+	}
+	return ts
+}
+
+func TestSendBatch(t *testing.T) {
+	batch := []timeSeries{
+		{
+			Labels: []prompbLabel{
+				{Name: "__name__", Value: "zerotrust_devices_up"},
+				{Name: "device_name", Value: "laptop é"},
+			},
+			Value:     1,
+			Timestamp: 1700000000123,
+		},
+		{
+			Labels:    []prompbLabel{{Name: "__name__", Value: "zerotrust_exporter_up"}},
+			Value:     -0.5,
+			Timestamp: 1700000000123,
+		},
+	}
+
+	var received []timeSeries
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Content-Encoding"); got != "snappy" {
+			t.Errorf("Content-Encoding = %q, want snappy", got)
+		}
+		if got := r.Header.Get("Content-Type"); got != "application/x-protobuf" {
+			t.Errorf("Content-Type = %q, want application/x-protobuf", got)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("Authorization = %q, want Bearer secret", got)
+		}
+		compressed, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("reading body: %v", err)
+		}
+		body, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			t.Fatalf("decoding snappy body: %v", err)
+		}
+		received = unmarshalWriteRequest(t, body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	config.RemoteWriteURL = server.URL
+	config.RemoteWriteBearerToken = "secret"
+	config.RemoteWriteMaxRetries = 0
+	sendBatch(context.Background(), server.Client(), batch)
+
+	if !reflect.DeepEqual(received, batch) {
+		t.Errorf("received %+v, want %+v", received, batch)
+	}
+}
+
+func TestPostRetry(t *testing.T) {
+	for _, tc := range []struct {
+		status int
+		retry  bool
+	}{
+		{http.StatusInternalServerError, true},
+		{http.StatusTooManyRequests, true},
+		{http.StatusBadRequest, false},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tc.status)
+		}))
+		config.RemoteWriteURL = server.URL
+		retry, err := post(context.Background(), server.Client(), nil)
+		server.Close()
+		if err == nil {
+			t.Errorf("status %d: expected an error", tc.status)
+		}
+		if retry != tc.retry {
+			t.Errorf("status %d: retry = %v, want %v", tc.status, retry, tc.retry)
+		}
+	}
+}
@@ -12,15 +12,21 @@ import (
 	"github.com/vinistoisr/zerotrust-exporter/internal/config"
 )
 
+// FetchTunnels fetches all non-deleted tunnels from Cloudflare API
+func FetchTunnels(ctx context.Context) ([]cloudflare.Tunnel, error) {
+	rc := &cloudflare.ResourceContainer{Level: cloudflare.AccountRouteLevel, Identifier: config.AccountID}
+	isDeleted := false
+	tunnels, _, err := config.GetClient().ListTunnels(ctx, rc, cloudflare.TunnelListParams{IsDeleted: &isDeleted})
+	return tunnels, err
+}
+
 // collectTunnelMetrics collects metrics for tunnels
 func CollectTunnelMetrics() {
 	appmetrics.IncApiCallCounter()
 	ctx := context.Background()
-	rc := &cloudflare.ResourceContainer{Level: cloudflare.AccountRouteLevel, Identifier: config.AccountID}
 	startTime := time.Now()
 	// Fetch tunnels from Cloudflare API
-	isDeleted := false
-	tunnels, _, err := config.Client.ListTunnels(ctx, rc, cloudflare.TunnelListParams{IsDeleted: &isDeleted})
+	tunnels, err := FetchTunnels(ctx)
 	if err != nil {
 		log.Printf("Error fetching tunnels: %v", err)
 		appmetrics.IncApiErrorsCounter()
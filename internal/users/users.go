@@ -20,11 +20,11 @@ type User struct {
 	// Add other fields as necessary
 }
 
-// fetchAllUsers fetches all users from Cloudflare API
-func fetchAllUsers(ctx context.Context) (map[string]*cloudflare.AccessUser, error) {
+// FetchAllUsers fetches all users from Cloudflare API
+func FetchAllUsers(ctx context.Context) (map[string]*cloudflare.AccessUser, error) {
 	rc := &cloudflare.ResourceContainer{Level: cloudflare.AccountRouteLevel, Identifier: config.AccountID}
 	startTime := time.Now()
-	usersList, _, err := config.Client.ListAccessUsers(ctx, rc, cloudflare.AccessUserParams{})
+	usersList, _, err := config.GetClient().ListAccessUsers(ctx, rc, cloudflare.AccessUserParams{})
 	if err != nil {
 		return nil, err
 	}
@@ -48,7 +48,7 @@ func CollectUserMetrics(deviceMetrics map[string]devices.DeviceStatus) {
 
 	ctx := context.Background()
 	// Fetch users from Cloudflare API
-	users, err := fetchAllUsers(ctx)
+	users, err := FetchAllUsers(ctx)
 	if err != nil {
 		log.Printf("Error fetching users: %v", err)
 		appmetrics.IncApiErrorsCounter()
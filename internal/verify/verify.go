@@ -0,0 +1,273 @@
+package verify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go"
+	"github.com/vinistoisr/zerotrust-exporter/internal/appmetrics"
+	"github.com/vinistoisr/zerotrust-exporter/internal/config"
+	"github.com/vinistoisr/zerotrust-exporter/internal/graphql"
+)
+
+const baseURL = "https://api.cloudflare.com/client/v4"
+
+// probes maps each collector to a cheap endpoint that needs the same token permission
+var probes = map[string]string{
+	"devices":       "/accounts/%s/dex/fleet-status/devices",
+	"users":         "/accounts/%s/access/users",
+	"tunnels":       "/accounts/%s/cfd_tunnel",
+	"dex":           "/accounts/%s/dex/tests",
+	"fleet":         "/accounts/%s/dex/fleet-status/live",
+	"commands":      "/accounts/%s/dex/commands/quota",
+	"registrations": "/accounts/%s/devices",
+	"posture":       "/accounts/%s/devices/posture",
+}
+
+// analyticsProbe queries a single group of a Gateway analytics dataset, which needs the
+// Account Analytics Read permission shared by the Gateway DNS, HTTP and network collectors
+const analyticsProbe = `query GatewayProbe($accountTag: string!, $start: Time!, $end: Time!) {
+  viewer {
+    accounts(filter: {accountTag: $accountTag}) {
+      gatewayResolverQueriesAdaptiveGroups(limit: 1, filter: {datetime_geq: $start, datetime_lt: $end}) {
+        count
+      }
+    }
+  }
+}`
+
+var (
+	mu       sync.RWMutex
+	disabled = make(map[string]bool)
+)
+
+// Allowed reports whether a collector has not been disabled by a failed permission check
+func Allowed(collector string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return !disabled[collector]
+}
+
+// enabledCollectors returns the collectors enabled in the config
+func enabledCollectors() []string {
+	enabled := map[string]bool{
+		"devices":       config.EnableDevices,
+		"users":         config.EnableUsers,
+		"tunnels":       config.EnableTunnels,
+		"dex":           config.EnableDex,
+		"fleet":         config.EnableFleetStatus,
+		"commands":      config.EnableDexCommands,
+		"registrations": config.EnableRegistrations,
+		"posture":       config.EnablePosture,
+		"gateway":       config.EnableGatewayDNS || config.EnableGatewayHTTP || config.EnableGatewayNetwork,
+	}
+	var collectors []string
+	for collector, ok := range enabled {
+		if ok {
+			collectors = append(collectors, collector)
+		}
+	}
+	sort.Strings(collectors)
+	return collectors
+}
+
+// Run verifies the API token and probes each enabled collector's endpoint once.
+// In "fail" mode an invalid token or missing permission is returned as an error,
+// in "disable" mode collectors without permission are skipped until the next check.
+func Run(ctx context.Context) error {
+	if config.ApiEmail != "" {
+		// Global API Keys cannot be checked with the token verify endpoint
+		if config.Debug {
+			log.Println("Skipping token verification for Global API Key authentication")
+		}
+	} else if err := verifyToken(ctx); err != nil {
+		return err
+	}
+
+	for _, collector := range enabledCollectors() {
+		ok, err := probe(ctx, collector)
+		if err != nil {
+			// Only a definite permission error changes the collector state
+			log.Printf("Error probing %s permission: %v", collector, err)
+			continue
+		}
+		appmetrics.SetCollectorPermission(collector, ok)
+		if !ok && config.VerifyMode == "fail" {
+			return fmt.Errorf("API token is missing the permission required by the %s collector", collector)
+		}
+		if !ok {
+			log.Printf("API token is missing the permission required by the %s collector, disabling it", collector)
+		} else if !Allowed(collector) {
+			log.Printf("API token permission for the %s collector restored, enabling it", collector)
+		}
+		mu.Lock()
+		disabled[collector] = !ok
+		mu.Unlock()
+	}
+	return nil
+}
+
+// verifyToken checks the token status and expiry, returning an error only in "fail" mode
+func verifyToken(ctx context.Context) error {
+	token, err := config.GetClient().VerifyAPIToken(ctx)
+	appmetrics.IncApiCallCounter()
+	if err != nil {
+		// Account-owned tokens can only be verified through the account endpoint
+		var accountErr error
+		if token, accountErr = verifyAccountToken(ctx); accountErr == nil {
+			err = nil
+		} else {
+			err = fmt.Errorf("%w, account token: %v", err, accountErr)
+		}
+	}
+	if err != nil {
+		appmetrics.IncApiErrorsCounter()
+		appmetrics.SetApiTokenValid(false)
+		if config.VerifyMode == "fail" {
+			return fmt.Errorf("failed to verify API token: %w", err)
+		}
+		log.Printf("Error verifying API token: %v", err)
+		return nil
+	}
+
+	valid := token.Status == "active"
+	appmetrics.SetApiTokenValid(valid)
+	appmetrics.SetApiTokenExpiry(token.ExpiresOn)
+	if config.Debug {
+		log.Printf("API token status: %s, expires on: %v", token.Status, token.ExpiresOn)
+	}
+	if !valid {
+		if config.VerifyMode == "fail" {
+			return fmt.Errorf("API token status is %q", token.Status)
+		}
+		log.Printf("API token status is %q", token.Status)
+	}
+	return nil
+}
+
+// verifyAccountToken verifies an account-owned API token
+func verifyAccountToken(ctx context.Context) (cloudflare.APITokenVerifyBody, error) {
+	var token cloudflare.APITokenVerifyBody
+	url := baseURL + fmt.Sprintf("/accounts/%s/tokens/verify", config.AccountID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return token, err
+	}
+	config.SetAuthHeaders(req)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	appmetrics.IncApiCallCounter()
+	if err != nil {
+		return token, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return token, fmt.Errorf("unexpected response: %s, response body: %s", resp.Status, string(bodyBytes))
+	}
+
+	var result struct {
+		Result  cloudflare.APITokenVerifyBody `json:"result"`
+		Success bool                          `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return token, fmt.Errorf("error decoding response: %w", err)
+	}
+	if !result.Success {
+		return token, fmt.Errorf("token verification was not successful")
+	}
+	return result.Result, nil
+}
+
+// Start re-runs the verification every VerifyInterval until ctx is cancelled
+func Start(ctx context.Context) {
+	ticker := time.NewTicker(config.VerifyInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := Run(ctx); err != nil {
+				log.Printf("Periodic token verification failed: %v", err)
+			}
+		}
+	}
+}
+
+// probe requests a single item from the collector's endpoint.
+// It returns false if the API rejected the token and an error if the result is inconclusive.
+func probe(ctx context.Context, collector string) (bool, error) {
+	if collector == "gateway" {
+		return probeAnalytics(ctx)
+	}
+	url := baseURL + fmt.Sprintf(probes[collector], config.AccountID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+	config.SetAuthHeaders(req)
+	req.Header.Set("Content-Type", "application/json")
+
+	q := req.URL.Query()
+	q.Add("per_page", "1")
+	q.Add("page", "1")
+	if collector == "devices" {
+		q.Add("time_end", time.Now().Format(time.RFC3339))
+		q.Add("time_start", time.Now().Add(-time.Minute*10).Format(time.RFC3339))
+	}
+	if collector == "fleet" {
+		q.Add("since_minutes", "10")
+	}
+	req.URL.RawQuery = q.Encode()
+
+	resp, err := http.DefaultClient.Do(req)
+	appmetrics.IncApiCallCounter()
+	if err != nil {
+		appmetrics.IncApiErrorsCounter()
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return false, nil
+	default:
+		appmetrics.IncApiErrorsCounter()
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return false, fmt.Errorf("unexpected response: %s, response body: %s", resp.Status, string(bodyBytes))
+	}
+}
+
+// probeAnalytics runs analyticsProbe over the last minute.
+// It returns false if the API rejected the token and an error if the result is inconclusive.
+func probeAnalytics(ctx context.Context) (bool, error) {
+	end := time.Now().Truncate(time.Minute)
+	var result json.RawMessage
+	err := graphql.NewClient(config.GraphQLEndpoint).Query(ctx, analyticsProbe, map[string]interface{}{
+		"accountTag": config.AccountID,
+		"start":      end.Add(-time.Minute).Format(time.RFC3339),
+		"end":        end.Format(time.RFC3339),
+	}, &result)
+	var queryErr *graphql.QueryError
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.As(err, &queryErr) && queryErr.Unauthorized():
+		return false, nil
+	default:
+		appmetrics.IncApiErrorsCounter()
+		return false, err
+	}
+}
@@ -1,76 +1,475 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/cloudflare/cloudflare-go"
+	"github.com/prometheus/exporter-toolkit/web"
 	"github.com/vinistoisr/zerotrust-exporter/internal/collector"
 	"github.com/vinistoisr/zerotrust-exporter/internal/config"
+	"github.com/vinistoisr/zerotrust-exporter/internal/devices"
+	"github.com/vinistoisr/zerotrust-exporter/internal/exposition"
+	"github.com/vinistoisr/zerotrust-exporter/internal/otlp"
+	"github.com/vinistoisr/zerotrust-exporter/internal/remotewrite"
+	"github.com/vinistoisr/zerotrust-exporter/internal/verify"
 )
 
 // Command-line flags
 var (
+	command       string
+	subcommand    string
 	apiKey        string
+	apiKeyFile    string
+	apiEmail      string
 	accountID     string
 	debug         bool
 	enableDevices bool
 	enableUsers   bool
 	enableTunnels bool
 	enableDex     bool
+	enableRegs    bool
+	enableGwDNS   bool
+	enableGwHTTP  bool
+	enableGwNet   bool
+	gwWindow      time.Duration
+	gwDelay       time.Duration
+	graphqlURL    string
+	staleAfter    time.Duration
+	enablePosture bool
+	postureMax    int
+	enableFleet   bool
+	enableCmds    bool
+	cmdsWindow    time.Duration
+	dexWindow     time.Duration
+	traceWindow   time.Duration
+	dexDevices    string
+	dexDevicesMax int
+	pathTests     string
+	pathDevices   string
+	fleetWindow   time.Duration
+	aggregateOnly bool
+	warpMinVer    string
+	lookback      time.Duration
 	listenAddr    string
 	port          int
+	disableHTTP   bool
+	webConfigFile string
+	webTokenFile  string
+	redactPolicy  string
+	redactKeyFile string
+	relabelConfig string
+	seriesLimit   int
+	seriesLimits  string
+	seriesAction  string
 	client        *cloudflare.API
+
+	remoteWriteURL         string
+	remoteWriteInterval    time.Duration
+	remoteWriteTimeout     time.Duration
+	remoteWriteBatchSize   int
+	remoteWriteQueueSize   int
+	remoteWriteMaxRetries  int
+	remoteWriteUsername    string
+	remoteWritePassword    string
+	remoteWriteBearerToken string
+
+	otlpProtocol string
+	otlpEndpoint string
+	otlpHeaders  string
+	otlpInterval time.Duration
+	otlpTimeout  time.Duration
+
+	verifyMode     string
+	verifyInterval time.Duration
 )
 
 func init() {
 	// Load environment variables if not set by flags
 	apiKey = os.Getenv("API_KEY")
+	apiKeyFile = os.Getenv("API_KEY_FILE")
+	apiEmail = os.Getenv("API_EMAIL")
 	accountID = os.Getenv("ACCOUNT_ID")
 	debug = os.Getenv("DEBUG") == "true"
 	enableDevices = os.Getenv("DEVICES") == "true"
 	enableUsers = os.Getenv("USERS") == "true"
 	enableTunnels = os.Getenv("TUNNELS") == "true"
 	enableDex = os.Getenv("DEX") == "true"
+	enableRegs = os.Getenv("REGISTRATIONS") == "true"
+	enableGwDNS = os.Getenv("GATEWAY_DNS") == "true"
+	enableGwHTTP = os.Getenv("GATEWAY_HTTP") == "true"
+	enableGwNet = os.Getenv("GATEWAY_NETWORK") == "true"
+	gwWindow = envDuration("GATEWAY_WINDOW", 5*time.Minute)
+	gwDelay = envDuration("GATEWAY_INGESTION_DELAY", 5*time.Minute)
+	graphqlURL = os.Getenv("GRAPHQL_ENDPOINT")
+	staleAfter = envDuration("REGISTRATIONS_STALE_AFTER", 30*24*time.Hour)
+	enablePosture = os.Getenv("POSTURE") == "true"
+	postureMax = envInt("POSTURE_MAX_DEVICES", 50)
+	enableFleet = os.Getenv("DEX_FLEET_STATUS") == "true"
+	enableCmds = os.Getenv("DEX_COMMANDS") == "true"
+	cmdsWindow = envDuration("DEX_COMMANDS_WINDOW", 24*time.Hour)
+	dexWindow = envDuration("DEX_TESTS_WINDOW", time.Hour)
+	traceWindow = envDuration("DEX_TRACEROUTE_WINDOW", time.Hour)
+	dexDevices = os.Getenv("DEX_DEVICES")
+	dexDevicesMax = envInt("DEX_DEVICES_MAX", 10)
+	pathTests = os.Getenv("DEX_NETWORK_PATH_TESTS")
+	pathDevices = os.Getenv("DEX_NETWORK_PATH_DEVICES")
+	fleetWindow = envDuration("DEX_FLEET_STATUS_WINDOW", time.Hour)
+	aggregateOnly = os.Getenv("DEVICES_AGGREGATE_ONLY") == "true"
+	warpMinVer = os.Getenv("WARP_MIN_VERSION")
+	lookback = envDuration("DEVICES_LOOKBACK", 10*time.Minute)
 	listenAddr = os.Getenv("INTERFACE")
 	port = 9184 // Default port
 	if portEnv := os.Getenv("PORT"); portEnv != "" {
 		fmt.Sscanf(portEnv, "%d", &port)
 	}
+	disableHTTP = os.Getenv("DISABLE_HTTP") == "true"
+	webConfigFile = os.Getenv("WEB_CONFIG_FILE")
+	webTokenFile = os.Getenv("WEB_BEARER_TOKEN_FILE")
+	redactPolicy = os.Getenv("REDACT")
+	redactKeyFile = os.Getenv("REDACT_KEY_FILE")
+	relabelConfig = os.Getenv("RELABEL_CONFIG")
+	seriesLimit = envInt("SERIES_LIMIT", 0)
+	seriesLimits = os.Getenv("SERIES_LIMITS")
+	seriesAction = exposition.LimitDrop
+	if env := os.Getenv("SERIES_LIMIT_ACTION"); env != "" {
+		seriesAction = env
+	}
+	remoteWriteURL = os.Getenv("REMOTE_WRITE_URL")
+	remoteWriteInterval = envDuration("REMOTE_WRITE_INTERVAL", time.Minute)
+	remoteWriteTimeout = envDuration("REMOTE_WRITE_TIMEOUT", 30*time.Second)
+	remoteWriteBatchSize = envInt("REMOTE_WRITE_BATCH_SIZE", 500)
+	remoteWriteQueueSize = envInt("REMOTE_WRITE_QUEUE_SIZE", 10000)
+	remoteWriteMaxRetries = envInt("REMOTE_WRITE_MAX_RETRIES", 5)
+	remoteWriteUsername = os.Getenv("REMOTE_WRITE_USERNAME")
+	remoteWritePassword = os.Getenv("REMOTE_WRITE_PASSWORD")
+	remoteWriteBearerToken = os.Getenv("REMOTE_WRITE_BEARER_TOKEN")
+	otlpProtocol = os.Getenv("OTLP_PROTOCOL")
+	otlpEndpoint = os.Getenv("OTLP_ENDPOINT")
+	otlpHeaders = os.Getenv("OTLP_HEADERS")
+	otlpInterval = envDuration("OTLP_INTERVAL", time.Minute)
+	otlpTimeout = envDuration("OTLP_TIMEOUT", 30*time.Second)
+	verifyMode = "disable"
+	if env := os.Getenv("VERIFY_MODE"); env != "" {
+		verifyMode = env
+	}
+	verifyInterval = envDuration("VERIFY_INTERVAL", time.Hour)
 
 	// Define command-line flags (override env variables if set)
 	flag.StringVar(&apiKey, "apikey", apiKey, "Cloudflare API key (required)")
+	flag.StringVar(&apiKeyFile, "apikey-file", apiKeyFile, "File to read the Cloudflare API key from, re-read on rotation")
+	flag.StringVar(&apiEmail, "email", apiEmail, "Account email for Global API Key authentication (default: API token authentication)")
 	flag.StringVar(&accountID, "accountid", accountID, "Cloudflare account ID (required)")
 	flag.BoolVar(&debug, "debug", debug, "Enable debug mode")
 	flag.BoolVar(&enableDevices, "devices", enableDevices, "Enable devices metrics")
 	flag.BoolVar(&enableUsers, "users", enableUsers, "Enable users metrics")
 	flag.BoolVar(&enableTunnels, "tunnels", enableTunnels, "Enable tunnels metrics")
 	flag.BoolVar(&enableDex, "dex", enableDex, "Enable dex metrics")
+	flag.DurationVar(&dexWindow, "dex-tests-window", dexWindow, "Query window of the DEX tests overview")
+	flag.DurationVar(&traceWindow, "dex-traceroute-window", traceWindow, "Query window of the DEX traceroute, per-device and network path results")
+	flag.StringVar(&dexDevices, "dex-devices", dexDevices, "Comma separated device IDs or user emails to collect per-device DEX results for")
+	flag.IntVar(&dexDevicesMax, "dex-devices-max", dexDevicesMax, "Maximum devices to collect per-device DEX results for")
+	flag.StringVar(&pathTests, "dex-network-path-tests", pathTests, "Comma separated traceroute test IDs to collect per-hop network paths for")
+	flag.StringVar(&pathDevices, "dex-network-path-devices", pathDevices, "Comma separated device IDs to collect per-hop network paths from")
+	flag.BoolVar(&enableFleet, "dex-fleet-status", enableFleet, "Enable aggregate DEX fleet status metrics")
+	flag.DurationVar(&fleetWindow, "dex-fleet-status-window", fleetWindow, "Window of the DEX fleet status over-time metrics")
+	flag.BoolVar(&enableCmds, "dex-commands", enableCmds, "Enable DEX remote capture command metrics")
+	flag.DurationVar(&cmdsWindow, "dex-commands-window", cmdsWindow, "Window of DEX commands reported by creation time")
+	flag.BoolVar(&enableGwDNS, "gateway-dns", enableGwDNS, "Enable Gateway DNS analytics metrics")
+	flag.BoolVar(&enableGwHTTP, "gateway-http", enableGwHTTP, "Enable Gateway HTTP policy analytics metrics")
+	flag.BoolVar(&enableGwNet, "gateway-network", enableGwNet, "Enable Gateway network policy analytics metrics")
+	flag.DurationVar(&gwWindow, "gateway-window", gwWindow, "Sliding window of the Gateway DNS metrics, and the first range counted by the HTTP and network metrics")
+	flag.DurationVar(&gwDelay, "gateway-ingestion-delay", gwDelay, "Time left for Gateway analytics to be ingested before a minute is queried")
+	flag.StringVar(&graphqlURL, "graphql-endpoint", graphqlURL, "GraphQL Analytics API endpoint (default: Cloudflare)")
+	flag.BoolVar(&enableRegs, "registrations", enableRegs, "Enable registered device inventory metrics")
+	flag.DurationVar(&staleAfter, "registrations-stale-after", staleAfter, "Age of the last check-in after which a registration is counted as stale")
+	flag.BoolVar(&enablePosture, "posture", enablePosture, "Enable device posture rule result metrics")
+	flag.IntVar(&postureMax, "posture-max-devices", postureMax, "Maximum devices whose posture results are fetched per collection (0 for unlimited)")
+	flag.DurationVar(&lookback, "devices-lookback", lookback, "Window of device check-ins fetched from the fleet status API")
+	flag.StringVar(&warpMinVer, "warp-min-version", warpMinVer, "Comma separated platform=version minimum WARP client versions, use default for all other platforms")
+	flag.BoolVar(&aggregateOnly, "devices-aggregate-only", aggregateOnly, "Only export fleet aggregate device metrics, skipping per-device series")
 	flag.StringVar(&listenAddr, "interface", listenAddr, "Listening interface (default: any)")
 	flag.IntVar(&port, "port", port, "Listening port (default: 9184)")
-	flag.Parse()
+	flag.StringVar(&webConfigFile, "web-config-file", webConfigFile, "Path to an exporter-toolkit web config file enabling TLS and basic auth")
+	flag.StringVar(&webTokenFile, "web-bearer-token-file", webTokenFile, "File containing a bearer token required to scrape /metrics")
+	flag.StringVar(&redactPolicy, "redact", redactPolicy, "Comma separated label=action redaction rules, actions: keep, drop, hash, mask")
+	flag.StringVar(&redactKeyFile, "redact-key-file", redactKeyFile, "File containing the HMAC key used to hash redacted labels")
+	flag.StringVar(&relabelConfig, "relabel-config", relabelConfig, "Path to a YAML file with per-family label settings and relabel rules")
+	flag.IntVar(&seriesLimit, "series-limit", seriesLimit, "Maximum series per metric family in the output (0 for unlimited)")
+	flag.StringVar(&seriesLimits, "series-limits", seriesLimits, "Comma separated family=limit overrides of series-limit")
+	flag.StringVar(&seriesAction, "series-limit-action", seriesAction, "Action for series beyond the limit: drop or other (aggregate into an other series)")
+	flag.BoolVar(&disableHTTP, "disable-http", disableHTTP, "Disable the /metrics HTTP server (push mode only)")
+	flag.StringVar(&remoteWriteURL, "remote-write-url", remoteWriteURL, "Prometheus remote write URL to push metrics to")
+	flag.DurationVar(&remoteWriteInterval, "remote-write-interval", remoteWriteInterval, "Interval between remote write collections")
+	flag.DurationVar(&remoteWriteTimeout, "remote-write-timeout", remoteWriteTimeout, "Timeout for a single remote write request")
+	flag.IntVar(&remoteWriteBatchSize, "remote-write-batch-size", remoteWriteBatchSize, "Maximum samples per remote write request")
+	flag.IntVar(&remoteWriteQueueSize, "remote-write-queue-size", remoteWriteQueueSize, "Maximum samples buffered for remote write")
+	flag.IntVar(&remoteWriteMaxRetries, "remote-write-max-retries", remoteWriteMaxRetries, "Maximum retries for a failed remote write request")
+	flag.StringVar(&remoteWriteUsername, "remote-write-username", remoteWriteUsername, "Basic auth username for remote write")
+	flag.StringVar(&remoteWritePassword, "remote-write-password", remoteWritePassword, "Basic auth password for remote write")
+	flag.StringVar(&remoteWriteBearerToken, "remote-write-bearer-token", remoteWriteBearerToken, "Bearer token for remote write")
+	flag.StringVar(&otlpProtocol, "otlp-protocol", otlpProtocol, "Export metrics via OTLP using grpc or http (default: disabled)")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", otlpEndpoint, "OTLP collector endpoint URL")
+	flag.StringVar(&otlpHeaders, "otlp-headers", otlpHeaders, "Comma separated key=value headers sent with OTLP exports")
+	flag.DurationVar(&otlpInterval, "otlp-interval", otlpInterval, "Interval between OTLP exports")
+	flag.DurationVar(&otlpTimeout, "otlp-timeout", otlpTimeout, "Timeout for a single OTLP export")
+	flag.StringVar(&verifyMode, "verify-mode", verifyMode, "Token permission check at startup: fail, disable (skip unauthorized collectors) or off")
+	flag.DurationVar(&verifyInterval, "verify-interval", verifyInterval, "Interval between token permission checks (0 to check only at startup)")
+
+	// An optional command and subcommand may precede the flags
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		subcommand, args = args[0], args[1:]
+	}
+	commandFlags(command).Parse(args)
+
+	if webConfigFile != "" {
+		if err := web.Validate(webConfigFile); err != nil {
+			log.Fatalf("Invalid web config file: %v", err)
+		}
+		if webTokenFile != "" {
+			basicAuth, err := collector.HasBasicAuthUsers(webConfigFile)
+			if err != nil {
+				log.Fatalf("Invalid web config file: %v", err)
+			}
+			if basicAuth {
+				fmt.Println("web-bearer-token-file cannot be combined with basic_auth_users in the web config file, both use the Authorization header")
+				flag.Usage()
+				os.Exit(1)
+			}
+		}
+	}
+
+	// Parse the label redaction policy
+	redactLabels, err := exposition.ParseRedactPolicy(redactPolicy)
+	if err != nil {
+		log.Fatalf("Invalid redaction policy: %v", err)
+	}
+	var redactKey []byte
+	for _, action := range redactLabels {
+		if action == exposition.RedactHash && redactKeyFile == "" {
+			log.Fatalf("The hash redaction action requires redact-key-file")
+		}
+	}
+	if redactKeyFile != "" {
+		data, err := os.ReadFile(redactKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to read redaction key file: %v", err)
+		}
+		// Trim the trailing newline of files written by echo or editors, as other tools do
+		redactKey = bytes.TrimSpace(data)
+		if len(redactKey) == 0 {
+			log.Fatalf("Redaction key file %s is empty", redactKeyFile)
+		}
+	}
+
+	// Load the relabel configuration
+	if relabelConfig != "" {
+		if err := exposition.LoadRelabelConfig(relabelConfig); err != nil {
+			log.Fatalf("Invalid relabel config: %v", err)
+		}
+	}
+
+	// Parse the cardinality limits
+	familyLimits, err := exposition.ParseSeriesLimits(seriesLimits)
+	if err != nil {
+		log.Fatalf("Invalid series limits: %v", err)
+	}
+	if seriesAction != exposition.LimitDrop && seriesAction != exposition.LimitOther {
+		log.Fatalf("series-limit-action must be drop or other")
+	}
+
+	// Parse the WARP client version policy
+	warpMinVersions, err := devices.ParseVersionPolicy(warpMinVer)
+	if err != nil {
+		log.Fatalf("Invalid WARP version policy: %v", err)
+	}
+
+	// Read the API key from a secret file if provided
+	if apiKeyFile != "" {
+		apiKey, err = config.ReadApiKeyFile(apiKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to read API key file: %v", err)
+		}
+	}
 
 	// Ensure required flags are provided
 	if apiKey == "" || accountID == "" {
-		fmt.Println("Both apikey and accountid are required")
+		fmt.Println("Both apikey (or apikey-file) and accountid are required")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if verifyMode != "fail" && verifyMode != "disable" && verifyMode != "off" {
+		fmt.Println("verify-mode must be one of fail, disable or off")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if (pathTests == "") != (pathDevices == "") {
+		fmt.Println("dex-network-path-tests and dex-network-path-devices must be set together")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if dexDevicesMax < 0 {
+		fmt.Println("dex-devices-max must not be negative")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if postureMax < 0 {
+		fmt.Println("posture-max-devices must not be negative")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if gwDelay < 0 {
+		fmt.Println("gateway-ingestion-delay must not be negative")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if remoteWriteURL != "" && remoteWriteInterval <= 0 {
+		fmt.Println("remote-write-interval must be positive")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if remoteWriteURL != "" && remoteWriteBatchSize <= 0 {
+		fmt.Println("remote-write-batch-size must be positive")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if remoteWriteURL != "" && remoteWriteQueueSize <= 0 {
+		fmt.Println("remote-write-queue-size must be positive")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if otlpProtocol != "" && otlpProtocol != "grpc" && otlpProtocol != "http" {
+		fmt.Println("otlp-protocol must be grpc or http")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if otlpProtocol != "" && otlpInterval <= 0 {
+		fmt.Println("otlp-interval must be positive")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if disableHTTP && remoteWriteURL == "" && otlpProtocol == "" {
+		fmt.Println("disable-http requires remote-write-url or otlp-protocol")
 		flag.Usage()
 		os.Exit(1)
 	}
 
 	// Initialize Cloudflare client
-	var err error
-	client, err = cloudflare.NewWithAPIToken(apiKey)
+	config.ApiKeyFile = apiKeyFile
+	config.ApiEmail = apiEmail
+	client, err = config.NewClient(apiKey)
 	if err != nil {
 		log.Fatalf("Failed to create Cloudflare client: %v", err)
 	}
 
 	// Initialize config
 	config.InitConfig(apiKey, accountID, debug, enableDevices, enableUsers, enableTunnels, enableDex, client)
+	config.DisableHTTP = disableHTTP
+	config.DevicesAggregateOnly = aggregateOnly
+	config.WarpMinVersions = warpMinVersions
+	config.DevicesLookback = lookback
+	config.DexTestsWindow = dexWindow
+	config.DexTracerouteWindow = traceWindow
+	config.DexDevices = splitList(dexDevices)
+	config.DexDevicesMax = dexDevicesMax
+	config.DexNetworkPathTests = splitList(pathTests)
+	config.DexNetworkPathDevices = splitList(pathDevices)
+	config.EnableFleetStatus = enableFleet
+	config.FleetStatusWindow = fleetWindow
+	config.EnableDexCommands = enableCmds
+	config.DexCommandsWindow = cmdsWindow
+	config.EnableRegistrations = enableRegs
+	config.EnableGatewayDNS = enableGwDNS
+	config.EnableGatewayHTTP = enableGwHTTP
+	config.EnableGatewayNetwork = enableGwNet
+	config.GatewayWindow = gwWindow
+	config.GatewayDelay = gwDelay
+	config.GraphQLEndpoint = graphqlURL
+	config.RegistrationsStaleAfter = staleAfter
+	config.EnablePosture = enablePosture
+	config.PostureMaxDevices = postureMax
+	config.WebConfigFile = webConfigFile
+	config.WebBearerTokenFile = webTokenFile
+	config.RedactLabels = redactLabels
+	config.RedactKey = redactKey
+	config.SeriesLimit = seriesLimit
+	config.SeriesLimits = familyLimits
+	config.SeriesLimitAction = seriesAction
+	config.RemoteWriteURL = remoteWriteURL
+	config.RemoteWriteInterval = remoteWriteInterval
+	config.RemoteWriteTimeout = remoteWriteTimeout
+	config.RemoteWriteBatchSize = remoteWriteBatchSize
+	config.RemoteWriteQueueSize = remoteWriteQueueSize
+	config.RemoteWriteMaxRetries = remoteWriteMaxRetries
+	config.RemoteWriteUsername = remoteWriteUsername
+	config.RemoteWritePassword = remoteWritePassword
+	config.RemoteWriteBearerToken = remoteWriteBearerToken
+	config.OTLPProtocol = otlpProtocol
+	config.OTLPEndpoint = otlpEndpoint
+	config.OTLPHeaders = otlpHeaders
+	config.OTLPInterval = otlpInterval
+	config.OTLPTimeout = otlpTimeout
+	config.VerifyMode = verifyMode
+	config.VerifyInterval = verifyInterval
+}
+
+// envInt reads an integer environment variable, falling back to def if unset or invalid
+func envInt(name string, def int) int {
+	value := def
+	if env := os.Getenv(name); env != "" {
+		fmt.Sscanf(env, "%d", &value)
+	}
+	return value
+}
+
+// splitList splits a comma separated list, dropping empty entries
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// envDuration reads a duration environment variable, falling back to def if unset or invalid
+func envDuration(name string, def time.Duration) time.Duration {
+	if env := os.Getenv(name); env != "" {
+		if value, err := time.ParseDuration(env); err == nil {
+			return value
+		}
+	}
+	return def
 }
 
 func main() {
+	if apiKeyFile != "" {
+		go config.WatchApiKeyFile(context.Background(), time.Minute)
+	}
+
+	switch command {
+	case "":
+	case "collect":
+		os.Exit(runCollect())
+	case "devices", "tunnels", "dex", "users":
+		os.Exit(runInspect(command, subcommand))
+	default:
+		fmt.Printf("Unknown command %q\n", command)
+		flag.Usage()
+		os.Exit(1)
+	}
+
 	addr := fmt.Sprintf("%s:%d", listenAddr, port)
 	if debug {
 		// Print debug information on startup
@@ -79,12 +478,44 @@ func main() {
 		log.Printf("Users metrics enabled: %v", enableUsers)
 		log.Printf("Tunnels metrics enabled: %v", enableTunnels)
 		log.Printf("Dex metrics enabled: %v", enableDex)
+		log.Printf("Fleet status metrics enabled: %v", enableFleet)
+		log.Printf("Dex commands metrics enabled: %v", enableCmds)
+		log.Printf("Registrations metrics enabled: %v", enableRegs)
+		log.Printf("Gateway DNS metrics enabled: %v", enableGwDNS)
+		log.Printf("Gateway HTTP metrics enabled: %v", enableGwHTTP)
+		log.Printf("Gateway network metrics enabled: %v", enableGwNet)
+		log.Printf("Posture metrics enabled: %v", enablePosture)
+		log.Printf("Remote write URL: %s", remoteWriteURL)
+		log.Printf("OTLP protocol: %s", otlpProtocol)
 		log.Printf("API Key: %s%s", "************", apiKey[len(apiKey)-4:])
 		log.Printf("Account ID: %s", accountID)
 	} else {
 		// Print normal startup message
 		log.Printf("Starting server on %s", addr)
 	}
+	if enablePosture && postureMax > 0 {
+		log.Printf("Posture results are fetched for at most %d devices per collection, rotating through the fleet", postureMax)
+	}
+
+	ctx := context.Background()
+	if verifyMode != "off" {
+		if err := verify.Run(ctx); err != nil {
+			log.Fatalf("Token verification failed: %v", err)
+		}
+		if verifyInterval > 0 {
+			go verify.Start(ctx)
+		}
+	}
+	if remoteWriteURL != "" {
+		go remotewrite.Start(ctx, collector.Collect)
+	}
+	if otlpProtocol != "" {
+		go otlp.Start(ctx, collector.Collect)
+	}
+	if disableHTTP {
+		// Push modes run until the process is stopped
+		select {}
+	}
 
 	collector.RegisterHandler()
 	collector.StartServer(addr)